@@ -0,0 +1,70 @@
+package sqlpool
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves a JSON admin API for the pool, e.g. mounted under
+// /debug/sqlpool/ with http.StripPrefix:
+//
+//	GET  /stats           Stats
+//	GET  /databases       ResourceStats
+//	POST /cleanup         runs Cleanup
+//	POST /evict?key=<key> closes the databases of a key, as listed by
+//	                      /databases (without credentials)
+//
+// It never exposes credentials, but lets anyone reaching it close databases:
+// don't serve it publicly
+func (p *Pool) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", p.handle(http.MethodGet, func(r *http.Request) (any, error) {
+		return p.Stats(), nil
+	}))
+	mux.HandleFunc("/databases", p.handle(http.MethodGet, func(r *http.Request) (any, error) {
+		return p.ResourceStats(), nil
+	}))
+	mux.HandleFunc("/cleanup", p.handle(http.MethodPost, func(r *http.Request) (any, error) {
+		return struct{}{}, p.CleanupContext(r.Context())
+	}))
+	mux.HandleFunc("/evict", p.handle(http.MethodPost, func(r *http.Request) (any, error) {
+		k := r.URL.Query().Get("key")
+		evicted := 0
+		err := p.CloseWhere(func(r *Resource) bool {
+			if r.redactedKey() != k {
+				return false
+			}
+			evicted++
+			return true
+		})
+		if evicted == 0 && err == nil {
+			return nil, ErrResourceNotFound
+		}
+		return struct {
+			Evicted int `json:"evicted"`
+		}{evicted}, err
+	}))
+	return mux
+}
+
+// handle serves fn's result as JSON, for requests with method only
+func (p *Pool) handle(method string, fn func(r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		res, err := fn(r)
+		if err == ErrResourceNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,58 @@
+package sqlpool
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"time"
+)
+
+// AcquireAffine acquires a database like Acquire, except that when fan-out
+// (see Opts.MaxUsersFor) opened several instances of it, a given affinity
+// (e.g. a session id) is consistently mapped to the same instance. If that
+// instance is saturated any other is used.
+func (p *Pool) AcquireAffine(driver, url, affinity string) (r *Resource, err error) {
+	defer func(start time.Time) {
+		p.observeWait(driver, url, start, err)
+	}(time.Now())
+
+	if err := p.drainError(driver); err != nil {
+		return nil, err
+	}
+
+	ctx, end := p.trace(context.Background(), "acquire", driver, url)
+	if r := p.affine(driver, url, affinity); r != nil && r.admit() && p.acquire(r) {
+		p.countHit(false)
+		end(nil)
+		return r, nil
+	}
+	r, err = p.take(ctx, driver, url)
+	end(err)
+	return r, err
+}
+
+// affine picks the instance affinity maps to using rendezvous hashing, so
+// adding or removing instances only remaps the affinities of those instances.
+// It returns nil if there's a single instance.
+func (p *Pool) affine(driver, url, affinity string) *Resource {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	instances := p.instances[p.keyOf(driver, url)]
+	if len(instances) < 2 {
+		return nil
+	}
+
+	var best *Resource
+	var bestScore uint64
+	for _, r := range instances {
+		h := fnv.New64a()
+		h.Write([]byte(affinity))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.Itoa(r.instance)))
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best, bestScore = r, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,66 @@
+package sqlpool
+
+import (
+	"time"
+)
+
+// Backoff bounds how long opening a database that failed to open is held
+// off: the delay starts at Min and doubles with each consecutive failure, up
+// to Max (zero means uncapped)
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// reconnect tracks the consecutive failed opens of a key
+type reconnect struct {
+	failures int
+	next     time.Time
+}
+
+// delay returns how long to wait after the nth consecutive failure
+func (b Backoff) delay(failures int) time.Duration {
+	d := b.Min
+	for i := 1; i < failures && (b.Max <= 0 || d < b.Max); i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// checkBackoff fails with ErrResourceDown while opening key is backing off
+func (p *Pool) checkBackoff(key string) error {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	if rc, ok := p.reconnects[key]; ok && p.now().Before(rc.next) {
+		return ErrResourceDown
+	}
+	return nil
+}
+
+// openFailed backs off opening key, it must be called with the pool's lock
+// held
+func (p *Pool) openFailed(key string) {
+	if p.opts.ReconnectBackoff.Min <= 0 {
+		return
+	}
+	rc, ok := p.reconnects[key]
+	if !ok {
+		rc = &reconnect{}
+		p.reconnects[key] = rc
+	}
+	rc.failures++
+	rc.next = p.now().Add(p.opts.ReconnectBackoff.delay(rc.failures))
+}
+
+// nextRetry returns when opening key may be retried, zero when it isn't
+// backing off. It must be called with the pool's lock held
+func (p *Pool) nextRetry(key string) time.Time {
+	if rc, ok := p.reconnects[key]; ok {
+		return rc.next
+	}
+	return time.Time{}
+}
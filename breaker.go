@@ -0,0 +1,57 @@
+package sqlpool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// BreakerState is the state of a resource's circuit breaker (see
+// Opts.BreakerThreshold)
+type BreakerState int
+
+const (
+	// Queries are succeeding
+	BreakerClosed BreakerState = iota
+	// Tripped, acquisitions are rejected until the cooldown is over
+	BreakerOpen
+	// Cooldown is over, waiting for a query to tell how the database is doing
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+func (r *Resource) breaker() BreakerState {
+	trippedAt := atomic.LoadInt64(&r.trippedAt)
+	if trippedAt == 0 {
+		return BreakerClosed
+	}
+	if time.Duration(r.pool.now().UnixNano()-trippedAt) < r.pool.opts.BreakerCooldown {
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+// admit reports whether r's breaker lets an acquisition through: always when
+// it's closed, and only one probe per cooldown when it's half-open
+func (r *Resource) admit() bool {
+	switch r.breaker() {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		return false
+	}
+	now := r.pool.now().UnixNano()
+	probedAt := atomic.LoadInt64(&r.probedAt)
+	if time.Duration(now-probedAt) < r.pool.opts.BreakerCooldown {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&r.probedAt, probedAt, now)
+}
@@ -0,0 +1,54 @@
+package sqlpool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+)
+
+// Opener opens databases, see Opts.Opener
+type Opener interface {
+	Open(driver, url string) (*sql.DB, error)
+}
+
+// OpenerFunc is a function used as an Opener
+type OpenerFunc func(driver, url string) (*sql.DB, error)
+
+func (f OpenerFunc) Open(driver, url string) (*sql.DB, error) {
+	return f(driver, url)
+}
+
+// ConnectorDriver is the driver of databases acquired with AcquireConnector,
+// their url is the connector's name
+const ConnectorDriver = "connector"
+
+// AcquireConnector acquires the database named name, opening it from c with
+// sql.OpenDB if needed, e.g. for pgx connectors or cloud SQL proxies. The
+// database can also be acquired with Acquire(ConnectorDriver, name) once c
+// is known, the latest connector given for a name is used by later opens
+func (p *Pool) AcquireConnector(name string, c driver.Connector) (*Resource, error) {
+	p.rw.Lock()
+	p.connectors[name] = c
+	p.rw.Unlock()
+
+	return p.Acquire(ConnectorDriver, name)
+}
+
+// openBase opens a database with Opts.Opener, its connector or sql.Open, it
+// is wrapped by Opts.OpenMiddleware
+func (p *Pool) openBase(ctx context.Context, driverName, url string) (*sql.DB, error) {
+	if driverName == ConnectorDriver {
+		p.rw.RLock()
+		c, ok := p.connectors[url]
+		p.rw.RUnlock()
+		if !ok {
+			return nil, ErrUnknownDriver
+		}
+		return sql.OpenDB(c), nil
+	}
+
+	if p.opts.Opener != nil {
+		return p.opts.Opener.Open(driverName, url)
+	}
+	return sql.Open(driverName, url)
+}
@@ -0,0 +1,143 @@
+package sqlpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AcquireContext is like Acquire but gives up once ctx is done, e.g. when
+// opening the database (or PostInit) hangs, returning ctx's error. The open
+// itself carries on in the background, unless a context-aware hook (see
+// Opts.PostInitContext) gives up too: if it succeeds, the database is left
+// idle in the pool for the next acquire.
+func (p *Pool) AcquireContext(ctx context.Context, driver, url string) (*Resource, error) {
+	start := time.Now()
+
+	ctx, end := p.trace(ctx, "acquire", driver, url)
+	r, err := p.acquireContext(ctx, driver, url)
+	end(err)
+	p.observeWait(driver, url, start, err)
+	return r, err
+}
+
+func (p *Pool) acquireContext(ctx context.Context, driver, url string) (*Resource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		r   *Resource
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		r, err := p.take(ctx, driver, url)
+		done <- result{r, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.r, res.err
+	case <-ctx.Done():
+		// Hand back what we get once it's too late, the caller never saw it
+		go func() {
+			if res := <-done; res.err == nil {
+				p.unuse(res.r, true)
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// ReleaseContext is like Release, tracing the release (and the cleanup
+// it may trigger) under ctx, see Opts.Trace
+func (p *Pool) ReleaseContext(ctx context.Context, r *Resource) error {
+	ctx, end := p.trace(ctx, "release", r.Driver, r.Url)
+	err := p.releaseResource(ctx, r)
+	end(err)
+	return err
+}
+
+// CloseContext closes every database like Close, waiting for them until ctx
+// is done: the ones still closing then are abandoned and reported in the
+// returned error, which wraps ctx's error, along with close errors.
+func (p *Pool) CloseContext(ctx context.Context) error {
+	resources := p.detachAll()
+	defer p.closeEvents()
+
+	type result struct {
+		r   *Resource
+		err error
+	}
+	results := make(chan result, len(resources))
+	for _, r := range resources {
+		go func(r *Resource) {
+			results <- result{r, p.closeResource(r)}
+		}(r)
+	}
+
+	errs := []error{p.leaked(resources)}
+	pending := map[*Resource]bool{}
+	for _, r := range resources {
+		pending[r] = true
+	}
+	for len(pending) > 0 {
+		select {
+		case res := <-results:
+			delete(pending, res.r)
+			if res.err != nil {
+				errs = append(errs, res.err)
+			}
+		case <-ctx.Done():
+			for r := range pending {
+				errs = append(errs, fmt.Errorf("Gave up closing %s: %w", r.redactedKey(), ctx.Err()))
+			}
+			return errors.Join(errs...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown closes the pool gracefully: acquires fail with ErrPoolClosed from
+// now on, idle databases are closed right away and the ones in use once
+// their users release them. If ctx is done first, the databases still in use
+// are closed under their users' feet and the returned error wraps ctx's
+// error, along with close errors.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	resources := p.detachAll()
+	defer p.closeEvents()
+
+	busy, err := p.closeWhenIdle(ctx, resources)
+	if len(busy) == 0 {
+		return err
+	}
+
+	errs := []error{err, p.leaked(busy)}
+	for _, r := range busy {
+		errs = append(errs, p.closeResource(r))
+	}
+	errs = append(errs, fmt.Errorf("Closed %d databases still in use: %w", len(busy), ctx.Err()))
+	return errors.Join(errs...)
+}
+
+// AcquireTimeout is like AcquireContext with a context timing out after
+// timeout: it then fails with an *ErrAcquireTimeout. Opts.AcquireTimeout
+// makes Acquire use it
+func (p *Pool) AcquireTimeout(driver, url string, timeout time.Duration) (*Resource, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	r, err := p.AcquireContext(ctx, driver, url)
+	if err != nil && errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+		return nil, &ErrAcquireTimeout{
+			Driver:     driver,
+			Url:        url,
+			Timeout:    timeout,
+			QueueDepth: p.QueueDepth(),
+			redact:     p.opts.Redactor,
+		}
+	}
+	return r, err
+}
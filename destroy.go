@@ -0,0 +1,48 @@
+package sqlpool
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// fileDrivers are the drivers whose urls are file paths, see Destroy
+var fileDrivers = map[string]bool{
+	"sqlite3": true,
+	"sqlite":  true,
+}
+
+// Destroy closes and removes the database like Invalidate with force, then
+// deletes its file along with its -wal, -shm and -journal sidecars, e.g. to
+// tear a tenant down. In-memory databases are only closed. Acquiring it in
+// the meantime creates it anew, so stop doing so first.
+//
+// It fails with ErrNotFileBased for drivers other than sqlite's
+func (p *Pool) Destroy(driver, url string) error {
+	if !fileDrivers[driver] {
+		return p.resourceError(ErrNotFileBased, driver, url)
+	}
+
+	closeErr := p.Invalidate(driver, url, true)
+
+	path, ok := sqlitePath(url)
+	if !ok {
+		return closeErr
+	}
+	errs := []error{closeErr}
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sqlitePath returns the file of a sqlite url, false for in-memory databases
+func sqlitePath(url string) (string, bool) {
+	path, query, _ := strings.Cut(strings.TrimPrefix(url, "file:"), "?")
+	if path == "" || path == ":memory:" || strings.Contains(query, "mode=memory") {
+		return "", false
+	}
+	return path, true
+}
@@ -0,0 +1,280 @@
+package sqlpool
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// How often draining checks whether busy resources were released
+var drainPollInterval = 10 * time.Millisecond
+
+// DrainDriver closes every resource of driver once its users release it, new
+// acquires for driver fail with ErrDriverDraining from now on. Other drivers
+// are left untouched.
+//
+// If ctx is done first, resources still in use are closed by their last
+// release and ctx's error is returned.
+func (p *Pool) DrainDriver(ctx context.Context, driver string) error {
+	// Stop handing out the driver's resources
+	p.rw.Lock()
+	p.draining[driver] = true
+	resources := []*Resource{}
+	for key, r := range p.databases {
+		if r.Driver == driver {
+			resources = append(resources, r)
+			p.removeResource(key)
+		}
+	}
+	p.rw.Unlock()
+
+	busy, err := p.closeWhenIdle(ctx, resources)
+	if len(busy) > 0 {
+		p.retire(busy)
+		return ctx.Err()
+	}
+	return err
+}
+
+// closeWhenIdle closes resources, already removed from the pool, as their
+// users release them. Once ctx is done it returns the ones still in use, it
+// returns the errors closing the others either way
+func (p *Pool) closeWhenIdle(ctx context.Context, resources []*Resource) ([]*Resource, error) {
+	var errs []error
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		// Close the ones nobody uses anymore
+		busy := resources[:0]
+		for _, r := range resources {
+			if r.users.IsActive() {
+				busy = append(busy, r)
+			} else if err := p.closeResource(r); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		resources = busy
+		if len(resources) == 0 {
+			return nil, errors.Join(errs...)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return resources, errors.Join(errs...)
+		}
+	}
+}
+
+// DrainEach takes the pool's resources out one at a time, as each is released
+// by its users, runs fn on it (e.g. for a final VACUUM) and closes it.
+// Resources opened after DrainEach is called are left alone.
+//
+// An error from fn aborts the drain and is returned, the resources not
+// reached yet stay in the pool. So do they if ctx is done first, then ctx's
+// error is returned. Otherwise the errors closing resources are joined.
+func (p *Pool) DrainEach(ctx context.Context, fn func(r *Resource) error) error {
+	p.rw.RLock()
+	pending := make([]*Resource, 0, len(p.databases))
+	for _, r := range p.databases {
+		pending = append(pending, r)
+	}
+	p.rw.RUnlock()
+
+	var errs []error
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for len(pending) > 0 {
+		r := p.takeIdle(&pending)
+		if r == nil {
+			select {
+			case <-ticker.C:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := fn(r); err != nil {
+			p.closeResource(r)
+			return err
+		}
+		if err := p.closeResource(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// takeIdle removes from the pool the first idle resource of pending and
+// returns it, resources already gone from the pool are dropped from pending
+func (p *Pool) takeIdle(pending *[]*Resource) *Resource {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	for i := 0; i < len(*pending); i++ {
+		r := (*pending)[i]
+		if p.databases[r.id()] == r && r.users.IsActive() {
+			continue
+		}
+		*pending = append((*pending)[:i], (*pending)[i+1:]...)
+		i--
+		if p.databases[r.id()] == r {
+			p.removeResource(r.id())
+			return r
+		}
+	}
+	return nil
+}
+
+// CloseWhere closes and removes every resource pred returns true for, the
+// errors closing them are joined. Resources in use are closed by their last
+// release.
+//
+// pred runs on a snapshot of the pool, without holding its lock
+func (p *Pool) CloseWhere(pred func(r *Resource) bool) error {
+	p.rw.RLock()
+	snapshot := make([]*Resource, 0, len(p.databases))
+	for _, r := range p.databases {
+		snapshot = append(snapshot, r)
+	}
+	p.rw.RUnlock()
+
+	matched := []*Resource{}
+	for _, r := range snapshot {
+		if pred(r) {
+			matched = append(matched, r)
+		}
+	}
+
+	// Remove the ones still in the pool
+	idle := []*Resource{}
+	p.rw.Lock()
+	for _, r := range matched {
+		if p.databases[r.id()] != r {
+			continue
+		}
+		p.removeResource(r.id())
+		if r.users.IsActive() {
+			r.retired = true
+		} else {
+			idle = append(idle, r)
+		}
+	}
+	p.rw.Unlock()
+
+	var errs []error
+	for _, r := range idle {
+		if err := p.closeResource(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Invalidate closes and removes every instance of the database, e.g. after
+// its credentials changed or its sqlite file was replaced: the next acquire
+// reopens it. Instances in use are closed by their last release, unless
+// force is set: they're then closed right away, under their users' feet.
+// Invalidating a database that isn't open is a no-op
+func (p *Pool) Invalidate(driver, url string, force bool) error {
+	p.rw.Lock()
+	resources := append([]*Resource{}, p.instances[p.keyOf(driver, url)]...)
+	closing := []*Resource{}
+	for _, r := range resources {
+		p.removeResource(r.id())
+		if r.users.IsActive() && !force {
+			r.retired = true
+		} else {
+			closing = append(closing, r)
+		}
+	}
+	p.rw.Unlock()
+
+	var errs []error
+	for _, r := range closing {
+		if err := p.closeResource(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WaitForIdle blocks until no database is in use (see InFlight), e.g. before
+// a backup or VACUUM that mustn't run during traffic, or in tests. Nothing
+// keeps databases from being acquired again once it returns. If ctx is done
+// first, ctx's error is returned
+func (p *Pool) WaitForIdle(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for p.InFlight() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Drain puts the whole pool in drain mode, e.g. while it's deregistered from
+// a load balancer before shutting down: new acquires fail with
+// ErrPoolDraining, idle databases are closed right away and the ones in use
+// once their last user releases them. It returns the errors closing idle
+// databases, and doesn't wait for the others, see Shutdown for that
+func (p *Pool) Drain() error {
+	p.rw.Lock()
+	p.drained = true
+	idle := []*Resource{}
+	for id, r := range p.databases {
+		if !r.users.IsActive() {
+			idle = append(idle, r)
+			p.removeResource(id)
+		}
+	}
+	p.rw.Unlock()
+
+	var errs []error
+	for _, r := range idle {
+		if err := p.closeResource(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Draining reports whether Drain was called
+func (p *Pool) Draining() bool {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+	return p.drained
+}
+
+// drainError tells why driver can't be acquired, if it's draining
+func (p *Pool) drainError(driver string) error {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+	if p.drained {
+		return ErrPoolDraining
+	}
+	if p.draining[driver] {
+		return ErrDriverDraining
+	}
+	return nil
+}
+
+// retire hands resources already removed from the pool over to their last
+// user for closing, idle ones are closed right away
+func (p *Pool) retire(resources []*Resource) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	for _, r := range resources {
+		if r.users.IsActive() {
+			r.retired = true
+		} else {
+			go p.cleanupResource(r)
+		}
+	}
+}
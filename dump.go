@@ -0,0 +1,74 @@
+package sqlpool
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+type poolDump struct {
+	Time      time.Time      `json:"time"`
+	Stats     Stats          `json:"stats"`
+	InFlight  int            `json:"in_flight"`
+	Resources []resourceDump `json:"resources"`
+}
+
+type resourceDump struct {
+	Key      string `json:"key"` // without credentials
+	Instance int    `json:"instance"`
+	Users    int64  `json:"users"`
+	Pinned   bool   `json:"pinned"`
+	ReadOnly bool   `json:"read_only"`
+	Breaker  string `json:"breaker"`
+
+	Age       time.Duration `json:"age"`
+	IdleFor   time.Duration `json:"idle_for,omitempty"`
+	NextRetry time.Time     `json:"next_retry"`
+
+	DBStats sql.DBStats `json:"db_stats"`
+}
+
+// Dump serializes the pool's state to JSON for debugging, e.g. as part of a
+// diagnostic bundle. It's a snapshot taken under the read lock, safe on a live
+// pool, and never includes credentials
+func (p *Pool) Dump() ([]byte, error) {
+	p.rw.RLock()
+	now := p.now()
+	dump := poolDump{
+		Time:      now,
+		Stats:     p.stats(),
+		InFlight:  p.InFlight(),
+		Resources: make([]resourceDump, 0, len(p.databases)),
+	}
+	for _, r := range p.databases {
+		d := resourceDump{
+			Key:      r.redactedKey(),
+			Instance: r.instance,
+			Users:    r.users.Get(),
+			Pinned:   r.pinned,
+			ReadOnly: r.ReadOnly(),
+			Breaker:  r.breaker().String(),
+
+			Age:       now.Sub(time.Unix(0, r.openedAt)),
+			NextRetry: p.nextRetry(r.Key()),
+
+			DBStats: r.DB.Stats(),
+		}
+		if _, idle := p.inactive[r.id()]; idle {
+			d.IdleFor = now.Sub(time.Unix(0, r.lastActive))
+		}
+		dump.Resources = append(dump.Resources, d)
+	}
+	p.rw.RUnlock()
+
+	sort.Slice(dump.Resources, func(i, j int) bool {
+		a, b := dump.Resources[i], dump.Resources[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Instance < b.Instance
+	})
+
+	return json.MarshalIndent(dump, "", "  ")
+}
@@ -0,0 +1,90 @@
+package sqlpool
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OptsFromEnv reads pool options from environment variables named
+// prefix + "_" + NAME, e.g. MYAPP_POOL_MAX for the prefix "MYAPP_POOL".
+// Unset (or empty) variables leave their field zero:
+//
+//	MAX                   Max, an integer
+//	IDLE_TIMEOUT          IdleTimeout, an integer number of seconds
+//	IDLE_TIMEOUT_JITTER   IdleTimeoutJitter, a duration such as "30s"
+//	CLOSE_ON_ZERO_USERS   CloseOnZeroUsers, a boolean such as "true" or "1"
+//	CLEANUP_CONCURRENCY   CleanupConcurrency, an integer
+//	MAX_CONCURRENT_OPENS  MaxConcurrentOpens, an integer
+//	STMT_CACHE_SIZE       StmtCacheSize, an integer
+//	SLOW_OPEN_THRESHOLD   SlowOpenThreshold, a duration
+//	BREAKER_THRESHOLD     BreakerThreshold, an integer
+//	BREAKER_COOLDOWN      BreakerCooldown, a duration
+//
+// Values that don't parse, or options that don't pass Opts.Validate, are
+// reported in the returned error
+func OptsFromEnv(prefix string) (Opts, error) {
+	opts := Opts{}
+	problems := []string{}
+	lookup := func(name string) (string, string, bool) {
+		name = prefix + "_" + name
+		value := strings.TrimSpace(os.Getenv(name))
+		return name, value, value != ""
+	}
+
+	ints := []struct {
+		name string
+		set  func(n int64)
+	}{
+		{"MAX", func(n int64) { opts.Max = n }},
+		{"IDLE_TIMEOUT", func(n int64) { opts.IdleTimeout = n }},
+		{"CLEANUP_CONCURRENCY", func(n int64) { opts.CleanupConcurrency = int(n) }},
+		{"MAX_CONCURRENT_OPENS", func(n int64) { opts.MaxConcurrentOpens = int(n) }},
+		{"STMT_CACHE_SIZE", func(n int64) { opts.StmtCacheSize = int(n) }},
+		{"BREAKER_THRESHOLD", func(n int64) { opts.BreakerThreshold = int(n) }},
+	}
+	for _, field := range ints {
+		if name, value, ok := lookup(field.name); ok {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be an integer, got %q", name, value))
+				continue
+			}
+			field.set(n)
+		}
+	}
+
+	durations := []struct {
+		name  string
+		field *time.Duration
+	}{
+		{"IDLE_TIMEOUT_JITTER", &opts.IdleTimeoutJitter},
+		{"SLOW_OPEN_THRESHOLD", &opts.SlowOpenThreshold},
+		{"BREAKER_COOLDOWN", &opts.BreakerCooldown},
+	}
+	for _, field := range durations {
+		if name, value, ok := lookup(field.name); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be a duration, got %q", name, value))
+				continue
+			}
+			*field.field = d
+		}
+	}
+
+	if name, value, ok := lookup("CLOSE_ON_ZERO_USERS"); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be a boolean, got %q", name, value))
+		}
+		opts.CloseOnZeroUsers = b
+	}
+
+	if len(problems) > 0 {
+		return Opts{}, fmt.Errorf("Invalid pool environment: %s", strings.Join(problems, "; "))
+	}
+	return opts, opts.Validate()
+}
@@ -0,0 +1,102 @@
+package sqlpool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrPoolFull            = errors.New("sqlpool: pool is full")
+	ErrPoolClosed          = errors.New("sqlpool: pool is closed")
+	ErrGroupFull           = errors.New("sqlpool: group is full")
+	ErrUnknownDriver       = errors.New("sqlpool: unknown driver")
+	ErrDriverDraining      = errors.New("sqlpool: driver is draining")
+	ErrPoolDraining        = errors.New("sqlpool: pool is draining")
+	ErrReadOnly            = errors.New("sqlpool: resource is read-only")
+	ErrResourceUnavailable = errors.New("sqlpool: resource is unavailable")
+	ErrResourceDown        = errors.New("sqlpool: resource is down")
+	ErrResourceNotFound    = errors.New("sqlpool: resource not found")
+	ErrCloseTimeout        = errors.New("sqlpool: close timed out")
+	ErrLeaked              = errors.New("sqlpool: resources still in use")
+	ErrResourceNotManaged  = errors.New("sqlpool: resource isn't managed by this pool")
+	ErrDoubleRelease       = errors.New("sqlpool: resource released more than acquired")
+	ErrNotFileBased        = errors.New("sqlpool: driver isn't file based")
+
+	// ErrMaxCapacity is another name of ErrPoolFull
+	ErrMaxCapacity = ErrPoolFull
+
+	errUnknownReason = errors.New("unknown reason")
+)
+
+// ErrOpenFailed is returned when a database couldn't be opened, it wraps the
+// error of the init function or driver that failed
+type ErrOpenFailed struct {
+	Driver string
+	Url    string
+	Err    error
+
+	redact Redactor // the pool's, if any
+}
+
+func (e *ErrOpenFailed) Error() string {
+	redact := e.redact
+	if redact == nil {
+		redact = Redact
+	}
+	return fmt.Sprintf("Failed to open %s://%s: %s", e.Driver, redact(e.Url), e.Err)
+}
+
+func (e *ErrOpenFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrAcquireTimeout is returned by AcquireTimeout when the database couldn't
+// be acquired in time, it wraps context.DeadlineExceeded
+type ErrAcquireTimeout struct {
+	Driver  string
+	Url     string
+	Timeout time.Duration
+	// QueueDepth is how many opens were waiting for room in the pool when it
+	// timed out, see Pool.QueueDepth
+	QueueDepth int
+
+	redact Redactor // the pool's, if any
+}
+
+func (e *ErrAcquireTimeout) Error() string {
+	redact := e.redact
+	if redact == nil {
+		redact = Redact
+	}
+	return fmt.Sprintf("Timed out acquiring %s://%s after %s (%d waiting)", e.Driver, redact(e.Url), e.Timeout, e.QueueDepth)
+}
+
+func (e *ErrAcquireTimeout) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// resourceError wraps err with the database it's about, for errors.Is
+func (p *Pool) resourceError(err error, driver, url string) error {
+	return fmt.Errorf("%w: %s", err, key(driver, p.redact(url)))
+}
+
+func (p *Pool) openError(driver, url string, err error) *ErrOpenFailed {
+	return &ErrOpenFailed{Driver: driver, Url: url, Err: err, redact: p.opts.Redactor}
+}
+
+// canceled reports whether err comes from a context that ended
+func canceled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func isRegistered(driver string) bool {
+	for _, name := range sql.Drivers() {
+		if name == driver {
+			return true
+		}
+	}
+	return false
+}
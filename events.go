@@ -0,0 +1,144 @@
+package sqlpool
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the kind of an Event
+type EventType int
+
+const (
+	EventOpen    EventType = iota // a database was opened, or failed to
+	EventClose                    // a database was closed, or failed to
+	EventEvict                    // an idle database was evicted
+	EventAcquire                  // a database was acquired, or failed to be
+	EventRelease                  // a database was released
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventOpen:
+		return "open"
+	case EventClose:
+		return "close"
+	case EventEvict:
+		return "evict"
+	case EventAcquire:
+		return "acquire"
+	case EventRelease:
+		return "release"
+	}
+	return "unknown"
+}
+
+// Event is a change in the pool's lifecycle, see Pool.Events
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Driver string
+	Url    string // without credentials
+
+	// How long the open or acquisition took
+	Duration time.Duration
+	// Why the open or close failed
+	Err error
+}
+
+// eventBuffer is how many events a subscriber may fall behind by
+const eventBuffer = 256
+
+type subscribers struct {
+	mu     sync.Mutex
+	chans  []chan Event
+	closed bool
+}
+
+// Events subscribes to the pool's lifecycle events. The channel is closed
+// once the pool is, events are dropped rather than waited for when it falls
+// more than 256 behind
+func (p *Pool) Events() <-chan Event {
+	s := &p.subscribers
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan Event, eventBuffer)
+	if s.closed {
+		close(ch)
+		return ch
+	}
+	s.chans = append(s.chans, ch)
+	return ch
+}
+
+// emit sends e to the subscribers, without blocking
+func (p *Pool) emit(typ EventType, driver, url string, d time.Duration, err error) {
+	s := &p.subscribers
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.chans) == 0 {
+		return
+	}
+	e := Event{
+		Type:     typ,
+		Time:     p.now(),
+		Driver:   driver,
+		Url:      p.redact(url),
+		Duration: d,
+		Err:      err,
+	}
+	for _, ch := range s.chans {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// closeEvents ends the subscriptions
+func (p *Pool) closeEvents() {
+	s := &p.subscribers
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, ch := range s.chans {
+		close(ch)
+	}
+	s.chans = nil
+}
+
+// reopenEvents accepts subscriptions again, see Pool.Reopen
+func (p *Pool) reopenEvents() {
+	s := &p.subscribers
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = false
+}
+
+// released reports a release to Opts.OnRelease and subscribers
+func (p *Pool) released(r *Resource) {
+	p.emit(EventRelease, r.Driver, r.Url, 0, nil)
+	if p.opts.OnRelease != nil {
+		p.opts.OnRelease(r)
+	}
+}
+
+// closeResource closes r, reporting it to Opts.OnClose and subscribers. It
+// must be called without the lock held
+func (p *Pool) closeResource(r *Resource) error {
+	err := r.close()
+	p.closedResource(r, err)
+	return err
+}
+
+func (p *Pool) closedResource(r *Resource, err error) {
+	p.emit(EventClose, r.Driver, r.Url, 0, err)
+	if p.opts.OnClose != nil {
+		p.opts.OnClose(r, err)
+	}
+}
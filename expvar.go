@@ -0,0 +1,22 @@
+package sqlpool
+
+import (
+	"expvar"
+)
+
+// PublishExpvar publishes the pool's stats under name in expvar (served at
+// /debug/vars), along with the users of each database. They're read live on
+// every request. Like expvar.Publish, it panics if name is already taken
+func (p *Pool) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		databases := map[string]int64{}
+		for _, r := range p.ResourceStats() {
+			databases[r.Key] += r.Users
+		}
+		return struct {
+			Stats
+			InFlight  int
+			Databases map[string]int64 // users by key, without credentials
+		}{p.Stats(), p.InFlight(), databases}
+	}))
+}
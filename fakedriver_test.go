@@ -0,0 +1,154 @@
+package sqlpool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fakeDriver is a database/sql driver whose behavior is controlled by its
+// DSN, to exercise the pool's error and timeout paths deterministically.
+// DSNs look like "name?open=fail&delay=10ms", options are:
+//
+//	open=fail       sql.Open fails
+//	delay=<d>       sql.Open takes d
+//	close=fail      DB.Close fails
+//	close=block     DB.Close blocks until fakeUnblock(name) is called
+//	closedelay=<d>  DB.Close takes d
+//	ping=fail       DB.Ping fails
+//	exec=fail       DB.Exec fails
+type fakeDriver struct{}
+
+type fakeConnector struct {
+	name string
+	opts url.Values
+}
+
+type fakeConn struct {
+	c *fakeConnector
+}
+
+var errFake = errors.New("fake failure")
+
+// Close calls in progress, the most seen at once and how many completed
+var fakeClosing, fakeMaxClosing, fakeClosed int64
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+func (d fakeDriver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+func (fakeDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	name, query, _ := strings.Cut(dsn, "?")
+	opts, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if delay, err := time.ParseDuration(opts.Get("delay")); err == nil {
+		time.Sleep(delay)
+	}
+	if opts.Get("open") == "fail" {
+		return nil, errFake
+	}
+	return &fakeConnector{name: name, opts: opts}, nil
+}
+
+func (c *fakeConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{c: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+// Close is called by DB.Close
+func (c *fakeConnector) Close() error {
+	closing := atomic.AddInt64(&fakeClosing, 1)
+	defer atomic.AddInt64(&fakeClosing, -1)
+	defer atomic.AddInt64(&fakeClosed, 1)
+	for {
+		max := atomic.LoadInt64(&fakeMaxClosing)
+		if closing <= max || atomic.CompareAndSwapInt64(&fakeMaxClosing, max, closing) {
+			break
+		}
+	}
+
+	if delay, err := time.ParseDuration(c.opts.Get("closedelay")); err == nil {
+		time.Sleep(delay)
+	}
+	switch c.opts.Get("close") {
+	case "fail":
+		return errFake
+	case "block":
+		<-fakeBlock(c.name)
+	}
+	return nil
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake: prepare not supported")
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake: transactions not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	if c.c.opts.Get("ping") == "fail" {
+		return errFake
+	}
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.c.opts.Get("exec") == "fail" {
+		return nil, errFake
+	}
+	return driver.RowsAffected(0), nil
+}
+
+var fakeBlocks = struct {
+	sync.Mutex
+	chans map[string]chan struct{}
+}{chans: map[string]chan struct{}{}}
+
+// fakeBlock returns the channel blocking name's Close
+func fakeBlock(name string) chan struct{} {
+	fakeBlocks.Lock()
+	defer fakeBlocks.Unlock()
+
+	ch, ok := fakeBlocks.chans[name]
+	if !ok {
+		ch = make(chan struct{})
+		fakeBlocks.chans[name] = ch
+	}
+	return ch
+}
+
+// fakeUnblock releases name's blocked Close calls, later ones block again
+func fakeUnblock(name string) {
+	ch := fakeBlock(name)
+
+	fakeBlocks.Lock()
+	defer fakeBlocks.Unlock()
+	delete(fakeBlocks.chans, name)
+	close(ch)
+}
@@ -0,0 +1,37 @@
+package sqlpool
+
+import "sync/atomic"
+
+// Handle is a single acquisition of a resource. Acquire hands the same
+// *Resource to all its users, so releasing it twice from one of them goes
+// unnoticed until the resource has been released more than acquired,
+// having stolen another user's release in the meantime. A Handle is
+// released once: releasing it again fails with ErrDoubleRelease and leaves
+// the resource alone
+type Handle struct {
+	*Resource
+	released int32
+}
+
+// AcquireHandle acquires the database like Acquire, returning a handle
+// specific to this acquisition
+func (p *Pool) AcquireHandle(driver, url string) (*Handle, error) {
+	r, err := p.Acquire(driver, url)
+	if err != nil {
+		return nil, err
+	}
+	return &Handle{Resource: r}, nil
+}
+
+// Release releases the handle's acquisition of the resource
+func (h *Handle) Release() error {
+	if !atomic.CompareAndSwapInt32(&h.released, 0, 1) {
+		return h.pool.resourceError(ErrDoubleRelease, h.Driver, h.Url)
+	}
+	return h.Resource.Release()
+}
+
+// Close releases the handle, see Resource.Close
+func (h *Handle) Close() error {
+	return h.Release()
+}
@@ -0,0 +1,71 @@
+package sqlpool
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// HealthCheck pings every idle database, evicting the ones failing to answer
+// so they aren't handed out again. Results are reported to
+// Opts.OnHealthCheck and counted in Stats
+func (p *Pool) HealthCheck(ctx context.Context) error {
+	p.rw.RLock()
+	idle := make([]*Resource, 0, len(p.inactive))
+	for _, r := range p.inactive {
+		idle = append(idle, r)
+	}
+	p.rw.RUnlock()
+
+	for _, r := range idle {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := r.DB.PingContext(ctx)
+		atomic.AddInt64(&p.healthChecks, 1)
+		if err != nil && ctx.Err() == nil {
+			atomic.AddInt64(&p.healthFailures, 1)
+			p.log.Warn("Health check failed", "db", r.redactedKey(), "err", err)
+			p.evictIdle(r)
+		}
+		if p.opts.OnHealthCheck != nil {
+			p.opts.OnHealthCheck(r, err)
+		}
+	}
+	return nil
+}
+
+// evictIdle removes r from the pool and closes it, unless it was acquired in
+// the meantime
+func (p *Pool) evictIdle(r *Resource) {
+	p.rw.Lock()
+	if p.inactive[r.id()] != r {
+		p.rw.Unlock()
+		return
+	}
+	idleFor := time.Duration(p.now().UnixNano() - r.lastActive)
+	atomic.AddInt64(&p.evictions, 1)
+	p.removeResource(r.id())
+	p.rw.Unlock()
+
+	p.evicted(r)
+	p.idleEnded(r, idleFor, false)
+	go p.cleanupResource(r)
+}
+
+// checkHealth runs HealthCheck every interval until ctx is done
+func (p *Pool) checkHealth(ctx context.Context, interval time.Duration) {
+	defer p.sweeper.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.HealthCheck(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
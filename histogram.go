@@ -0,0 +1,47 @@
+package sqlpool
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var DefaultWaitBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// WaitOverflow is WaitHistogram's bucket for waits longer than the largest
+// of Opts.WaitBuckets
+const WaitOverflow = time.Duration(math.MaxInt64)
+
+// WaitHistogram returns how many acquisitions took how long, by bucket: each
+// acquisition is counted in the smallest bucket it fits in.
+func (p *Pool) WaitHistogram() map[time.Duration]int64 {
+	histogram := make(map[time.Duration]int64, len(p.waits))
+	for i, bucket := range p.waitBuckets {
+		histogram[bucket] = atomic.LoadInt64(&p.waits[i])
+	}
+	histogram[WaitOverflow] = atomic.LoadInt64(&p.waits[len(p.waitBuckets)])
+	return histogram
+}
+
+// observeWait records an acquisition started at start, and its error
+func (p *Pool) observeWait(driver, url string, start time.Time, err error) {
+	d := time.Since(start)
+	if p.opts.OnAcquire != nil {
+		p.opts.OnAcquire(driver, url, d, err)
+	}
+	p.emit(EventAcquire, driver, url, d, err)
+	i := sort.Search(len(p.waitBuckets), func(i int) bool {
+		return d <= p.waitBuckets[i]
+	})
+	atomic.AddInt64(&p.waits[i], 1)
+}
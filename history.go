@@ -0,0 +1,68 @@
+package sqlpool
+
+import (
+	"container/list"
+	"time"
+)
+
+// How many keys the open history remembers
+var openHistorySize = 1024
+
+// openHistory is a LRU of the latest open outcomes per key, it outlives the
+// keys' resources. It's guarded by the pool's lock
+type openHistory struct {
+	lru  *list.List
+	keys map[string]*list.Element
+}
+
+type openRecord struct {
+	key         string
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+	errors      int64
+}
+
+func newOpenHistory() *openHistory {
+	return &openHistory{
+		lru:  list.New(),
+		keys: map[string]*list.Element{},
+	}
+}
+
+// record notes the outcome of opening key at t
+func (h *openHistory) record(key string, t time.Time, err error) {
+	e, ok := h.keys[key]
+	if ok {
+		h.lru.MoveToFront(e)
+	} else {
+		e = h.lru.PushFront(&openRecord{key: key})
+		h.keys[key] = e
+	}
+	rec := e.Value.(*openRecord)
+	if err != nil {
+		rec.lastFailure = t
+		rec.lastError = err.Error()
+		rec.errors++
+	} else {
+		rec.lastSuccess = t
+	}
+
+	// Evict least recently opened
+	for h.lru.Len() > openHistorySize {
+		e := h.lru.Back()
+		h.lru.Remove(e)
+		delete(h.keys, e.Value.(*openRecord).key)
+	}
+}
+
+// fill copies key's history into stats
+func (h *openHistory) fill(key string, stats *ResourceStats) {
+	if e, ok := h.keys[key]; ok {
+		rec := e.Value.(*openRecord)
+		stats.LastOpenSuccess = rec.lastSuccess
+		stats.LastOpenFailure = rec.lastFailure
+		stats.LastOpenError = rec.lastError
+		stats.OpenErrors = rec.errors
+	}
+}
@@ -0,0 +1,41 @@
+package sqlpool
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// Inventory lists the databases currently open, so they can be warmed again
+// with RestoreInventory after a restart. Credentials are stripped from the
+// urls: DSNs that embed them need to be completed before being restored.
+func (p *Pool) Inventory() []Target {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	targets := make([]Target, 0, len(p.instances))
+	for _, instances := range p.instances {
+		r := instances[0]
+		targets = append(targets, Target{
+			Driver: r.Driver,
+			Url:    p.redact(r.Url),
+		})
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Key() < targets[j].Key()
+	})
+
+	return targets
+}
+
+// RestoreInventory opens targets, leaving them idle in the pool, and returns
+// the errors of the ones that failed
+func (p *Pool) RestoreInventory(targets []Target) error {
+	var errs []error
+	for _, t := range targets {
+		if _, err := p.warm(context.Background(), t); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,29 @@
+package sqlpool
+
+import "log/slog"
+
+// Logger receives the pool's logs: failed opens and closes, evictions, ...
+// keyvals alternate keys and values, e.g. "db", "mysql:localhost/app".
+// *slog.Logger implements it, see package logrusadapter for logrus
+type Logger interface {
+	Debug(msg string, keyvals ...any)
+	Info(msg string, keyvals ...any)
+	Warn(msg string, keyvals ...any)
+	Error(msg string, keyvals ...any)
+}
+
+// SlogLogger logs to l, or to slog's default logger if l is nil
+func SlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
+
+// nopLogger discards logs, when Opts.Logger isn't set
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, keyvals ...any) {}
+func (nopLogger) Info(msg string, keyvals ...any)  {}
+func (nopLogger) Warn(msg string, keyvals ...any)  {}
+func (nopLogger) Error(msg string, keyvals ...any) {}
@@ -0,0 +1,42 @@
+// Package logrusadapter logs the messages of a sqlpool.Pool with logrus
+package logrusadapter
+
+import (
+	"fmt"
+
+	"github.com/GitbookIO/go-sqlpool"
+	"github.com/sirupsen/logrus"
+)
+
+type logger struct {
+	log logrus.FieldLogger
+}
+
+// New returns a sqlpool.Logger logging to log, key-value pairs become fields
+func New(log logrus.FieldLogger) sqlpool.Logger {
+	return logger{log: log}
+}
+
+func (l logger) Debug(msg string, keyvals ...any) { l.with(keyvals).Debug(msg) }
+func (l logger) Info(msg string, keyvals ...any)  { l.with(keyvals).Info(msg) }
+func (l logger) Warn(msg string, keyvals ...any)  { l.with(keyvals).Warn(msg) }
+func (l logger) Error(msg string, keyvals ...any) { l.with(keyvals).Error(msg) }
+
+func (l logger) with(keyvals []any) logrus.FieldLogger {
+	if len(keyvals) == 0 {
+		return l.log
+	}
+	fields := make(logrus.Fields, len(keyvals)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		var v any = "(MISSING)"
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		if err, ok := v.(error); ok && keyvals[i] == "err" {
+			fields[logrus.ErrorKey] = err
+			continue
+		}
+		fields[fmt.Sprint(keyvals[i])] = v
+	}
+	return l.log.WithFields(fields)
+}
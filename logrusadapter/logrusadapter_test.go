@@ -0,0 +1,33 @@
+package logrusadapter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLogger(t *testing.T) {
+	log, hook := test.NewNullLogger()
+	log.SetLevel(logrus.DebugLevel)
+
+	l := New(log)
+	l.Warn("Opening database failed", "db", "fake:down", "err", errors.New("boom"))
+	l.Debug("Odd", "key")
+
+	entries := hook.AllEntries()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Level != logrus.WarnLevel || e.Message != "Opening database failed" {
+		t.Errorf("Unexpected entry %s %q", e.Level, e.Message)
+	}
+	if e.Data["db"] != "fake:down" || e.Data[logrus.ErrorKey].(error).Error() != "boom" {
+		t.Errorf("Unexpected fields %v", e.Data)
+	}
+	if entries[1].Data["key"] != "(MISSING)" {
+		t.Errorf("Unexpected fields %v", entries[1].Data)
+	}
+}
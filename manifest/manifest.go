@@ -0,0 +1,105 @@
+// Package manifest loads the databases to warm a sqlpool.Pool up with from a
+// JSON or YAML manifest, so deployments can declare their fleet without
+// writing Go code:
+//
+//	databases:
+//	  - driver: postgres
+//	    url: postgres://app@db/main
+//	    pin: true
+//	  - driver: sqlite3
+//	    url: /data/tenants/acme.db
+//	    read_only: true
+//	    optional: true
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/GitbookIO/go-sqlpool"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest lists databases to warm up
+type Manifest struct {
+	Databases []Entry `json:"databases" yaml:"databases"`
+}
+
+// Entry is a database of the manifest and how to set it up
+type Entry struct {
+	Driver string `json:"driver" yaml:"driver"`
+	Url    string `json:"url" yaml:"url"`
+
+	// Pin keeps the database open while idle, see Pool.Pin
+	Pin bool `json:"pin" yaml:"pin"`
+	// ReadOnly marks it read-only, see Pool.SetReadOnly
+	ReadOnly bool `json:"read_only" yaml:"read_only"`
+	// Optional databases failing to open don't fail Warmup
+	Optional bool `json:"optional" yaml:"optional"`
+}
+
+// Load reads a JSON or YAML manifest, rejecting unknown fields
+func Load(r io.Reader) (*Manifest, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	m := &Manifest{}
+	if err := dec.Decode(m); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Invalid manifest: %w", err)
+	}
+	for i, e := range m.Databases {
+		if e.Driver == "" || e.Url == "" {
+			return nil, fmt.Errorf("Invalid manifest: database %d needs a driver and url", i)
+		}
+	}
+	return m, nil
+}
+
+// LoadFS reads the manifest at name in fsys, e.g. an embed.FS
+func LoadFS(fsys fs.FS, name string) (*Manifest, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Targets lists the manifest's databases
+func (m *Manifest) Targets() []sqlpool.Target {
+	targets := make([]sqlpool.Target, len(m.Databases))
+	for i, e := range m.Databases {
+		targets[i] = sqlpool.Target{Driver: e.Driver, Url: e.Url}
+	}
+	return targets
+}
+
+// Warmup sets the manifest's databases up in pool and opens them with
+// Pool.Warmup, it returns the errors of the databases that aren't optional
+func (m *Manifest) Warmup(ctx context.Context, pool *sqlpool.Pool) error {
+	for _, e := range m.Databases {
+		if e.ReadOnly {
+			pool.SetReadOnly(e.Driver, e.Url, true)
+		}
+	}
+
+	var errs []error
+	for i, err := range pool.Warmup(ctx, m.Targets()) {
+		e := m.Databases[i]
+		if err != nil {
+			if !e.Optional {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if e.Pin {
+			if r, ok := pool.Peek(e.Driver, e.Url); ok {
+				pool.Pin(r)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
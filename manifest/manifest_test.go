@@ -0,0 +1,85 @@
+package manifest
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/GitbookIO/go-sqlpool"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestLoad(t *testing.T) {
+	yamlManifest := `
+databases:
+  - driver: sqlite3
+    url: /tmp/sqlpool_test_manifest.db
+    pin: true
+    read_only: true
+  - driver: sqlite3
+    url: /nonexistent/dir/tenant.db?mode=ro
+    optional: true
+`
+	jsonManifest := `{"databases": [
+		{"driver": "sqlite3", "url": "/tmp/sqlpool_test_manifest.db", "pin": true, "read_only": true},
+		{"driver": "sqlite3", "url": "/nonexistent/dir/tenant.db?mode=ro", "optional": true}
+	]}`
+	fsys := fstest.MapFS{"db.json": {Data: []byte(jsonManifest)}}
+
+	fromYAML, err := Load(strings.NewReader(yamlManifest))
+	if err != nil {
+		t.Fatalf("Error loading YAML manifest: %s", err)
+	}
+	fromJSON, err := LoadFS(fsys, "db.json")
+	if err != nil {
+		t.Fatalf("Error loading JSON manifest: %s", err)
+	}
+
+	for _, m := range []*Manifest{fromYAML, fromJSON} {
+		if len(m.Databases) != 2 || !m.Databases[0].Pin || !m.Databases[0].ReadOnly || !m.Databases[1].Optional {
+			t.Errorf("Unexpected manifest %+v", m)
+		}
+	}
+
+	if _, err := Load(strings.NewReader("databases:\n  - driver: sqlite3\n    uri: typo\n")); err == nil {
+		t.Errorf("Expected unknown fields to be rejected")
+	}
+	if _, err := Load(strings.NewReader("databases:\n  - driver: sqlite3\n")); err == nil {
+		t.Errorf("Expected entries without url to be rejected")
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	pool := sqlpool.NewPool(sqlpool.Opts{
+		Max:         10,
+		IdleTimeout: 30,
+		PostInit: func(driver, url string, db *sql.DB) error {
+			return db.Ping()
+		},
+	})
+	defer pool.Close()
+
+	m := &Manifest{Databases: []Entry{
+		{Driver: "sqlite3", Url: "/tmp/sqlpool_test_manifest.db", Pin: true, ReadOnly: true},
+		{Driver: "sqlite3", Url: "/nonexistent/dir/tenant.db", Optional: true},
+	}}
+	if err := m.Warmup(context.Background(), pool); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	r, ok := pool.Peek("sqlite3", "/tmp/sqlpool_test_manifest.db")
+	if !ok || !r.ReadOnly() {
+		t.Fatalf("Expected the database to be open and read-only")
+	}
+	if stats := pool.Stats(); stats.Total != 1 || stats.Pinned != 1 {
+		t.Errorf("Expected the database to be pinned, got %+v", stats)
+	}
+
+	m.Databases[1].Optional = false
+	if err := m.Warmup(context.Background(), pool); err == nil {
+		t.Errorf("Expected required databases failing to fail the warmup")
+	}
+}
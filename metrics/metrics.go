@@ -0,0 +1,111 @@
+// Package metrics exports the stats of a sqlpool.Pool to Prometheus
+package metrics
+
+import (
+	"sort"
+
+	"github.com/GitbookIO/go-sqlpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector reading a pool's stats on every scrape
+type Collector struct {
+	pool *sqlpool.Pool
+
+	databases  *prometheus.Desc
+	active     *prometheus.Desc
+	inactive   *prometheus.Desc
+	pinned     *prometheus.Desc
+	acquires   *prometheus.Desc
+	releases   *prometheus.Desc
+	evictions  *prometheus.Desc
+	openErrors *prometheus.Desc
+
+	// sql.DBStats, summed per driver
+	openConns    *prometheus.Desc
+	inUseConns   *prometheus.Desc
+	idleConns    *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+// NewCollector returns a collector for pool, its metrics are prefixed by
+// namespace (e.g. "myapp_sqlpool")
+func NewCollector(pool *sqlpool.Pool, namespace string) *Collector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+	}
+	return &Collector{
+		pool: pool,
+
+		databases:  desc("databases", "Databases open in the pool."),
+		active:     desc("databases_active", "Databases with at least one user."),
+		inactive:   desc("databases_inactive", "Databases idle in the pool."),
+		pinned:     desc("databases_pinned", "Idle databases kept open by Pin."),
+		acquires:   desc("acquires_total", "Successful acquisitions."),
+		releases:   desc("releases_total", "Releases."),
+		evictions:  desc("evictions_total", "Idle databases evicted."),
+		openErrors: desc("open_errors_total", "Databases that failed to open."),
+
+		openConns:    desc("db_open_connections", "Connections open by the pool's databases.", "driver"),
+		inUseConns:   desc("db_in_use_connections", "Connections in use by the pool's databases.", "driver"),
+		idleConns:    desc("db_idle_connections", "Idle connections of the pool's databases.", "driver"),
+		waitCount:    desc("db_wait_count_total", "Connections waited for by the pool's open databases.", "driver"),
+		waitDuration: desc("db_wait_duration_seconds_total", "Time spent waiting for connections by the pool's open databases.", "driver"),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.databases, c.active, c.inactive, c.pinned,
+		c.acquires, c.releases, c.evictions, c.openErrors,
+		c.openConns, c.inUseConns, c.idleConns, c.waitCount, c.waitDuration,
+	} {
+		ch <- d
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.pool.Stats()
+	ch <- prometheus.MustNewConstMetric(c.databases, prometheus.GaugeValue, float64(stats.Total))
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(stats.Active))
+	ch <- prometheus.MustNewConstMetric(c.inactive, prometheus.GaugeValue, float64(stats.Inactive))
+	ch <- prometheus.MustNewConstMetric(c.pinned, prometheus.GaugeValue, float64(stats.Pinned))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stats.Acquires))
+	ch <- prometheus.MustNewConstMetric(c.releases, prometheus.CounterValue, float64(stats.Releases))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.openErrors, prometheus.CounterValue, float64(stats.OpenErrors))
+
+	// Sum connection stats per driver
+	type driverStats struct {
+		open, inUse, idle, waits int
+		waited                   float64
+	}
+	drivers := map[string]*driverStats{}
+	for _, r := range c.pool.ResourceStats() {
+		d, ok := drivers[r.Driver]
+		if !ok {
+			d = &driverStats{}
+			drivers[r.Driver] = d
+		}
+		d.open += r.DBStats.OpenConnections
+		d.inUse += r.DBStats.InUse
+		d.idle += r.DBStats.Idle
+		d.waits += int(r.DBStats.WaitCount)
+		d.waited += r.DBStats.WaitDuration.Seconds()
+	}
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		d := drivers[name]
+		ch <- prometheus.MustNewConstMetric(c.openConns, prometheus.GaugeValue, float64(d.open), name)
+		ch <- prometheus.MustNewConstMetric(c.inUseConns, prometheus.GaugeValue, float64(d.inUse), name)
+		ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(d.idle), name)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(d.waits), name)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, d.waited, name)
+	}
+}
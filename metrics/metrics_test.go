@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GitbookIO/go-sqlpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCollector(t *testing.T) {
+	pool := sqlpool.NewPool(sqlpool.Opts{
+		Max:         10,
+		IdleTimeout: 30,
+	})
+	defer pool.Close()
+
+	r, err := pool.Acquire("sqlite3", "/tmp/sqlpool_test_metrics.db")
+	if err != nil {
+		t.Fatalf("Error opening tmp database: %s", err)
+	}
+	if err := r.DB.Ping(); err != nil {
+		t.Fatalf("Error pinging tmp database: %s", err)
+	}
+	defer pool.Release(r)
+
+	c := NewCollector(pool, "sqlpool")
+	expected := `
+# HELP sqlpool_databases_active Databases with at least one user.
+# TYPE sqlpool_databases_active gauge
+sqlpool_databases_active 1
+# HELP sqlpool_acquires_total Successful acquisitions.
+# TYPE sqlpool_acquires_total counter
+sqlpool_acquires_total 1
+# HELP sqlpool_db_open_connections Connections open by the pool's databases.
+# TYPE sqlpool_db_open_connections gauge
+sqlpool_db_open_connections{driver="sqlite3"} 1
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"sqlpool_databases_active", "sqlpool_acquires_total", "sqlpool_db_open_connections")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,60 @@
+package sqlpool
+
+import (
+	neturl "net/url"
+	"path"
+	"strings"
+)
+
+// keyUrl returns the url identifying the database, see Opts.KeyFunc
+func (p *Pool) keyUrl(driver, url string) string {
+	if p.opts.KeyFunc == nil {
+		return url
+	}
+	return p.opts.KeyFunc(driver, url)
+}
+
+// keyOf returns the key the database is filed under
+func (p *Pool) keyOf(driver, url string) string {
+	return key(driver, p.keyUrl(driver, url))
+}
+
+// NormalizeDSN is an Opts.KeyFunc for common DSNs: sqlite paths are
+// cleaned (/tmp/../tmp/a.db is /tmp/a.db) and the query parameters of
+// sqlite and URL-style DSNs (postgres://...) sorted. Other DSNs are kept
+// as is
+func NormalizeDSN(driver, url string) string {
+	if fileDrivers[driver] {
+		file, query, hasQuery := strings.Cut(url, "?")
+		prefix := ""
+		if strings.HasPrefix(file, "file:") {
+			prefix, file = "file:", strings.TrimPrefix(file, "file:")
+		}
+		if file != "" && !strings.HasPrefix(file, ":") {
+			file = path.Clean(file)
+		}
+		if hasQuery {
+			return prefix + file + "?" + sortQuery(query)
+		}
+		return prefix + file
+	}
+
+	if !strings.Contains(url, "://") {
+		return url
+	}
+	if u, err := neturl.Parse(url); err == nil && u.RawQuery != "" {
+		u.RawQuery = sortQuery(u.RawQuery)
+		return u.String()
+	}
+	return url
+}
+
+// sortQuery sorts query's parameters by key, keeping it as is if it doesn't
+// parse
+func sortQuery(query string) string {
+	values, err := neturl.ParseQuery(query)
+	if err != nil {
+		return query
+	}
+	return values.Encode()
+}
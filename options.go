@@ -0,0 +1,65 @@
+package sqlpool
+
+import "time"
+
+// Option configures a pool created by New
+type Option func(o *Opts)
+
+// New creates a pool configured by opts, applied in order over the zero
+// Opts. Unlike NewPool, the resulting options are validated
+func New(opts ...Option) (*Pool, error) {
+	o := Opts{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return NewPoolWithValidation(o)
+}
+
+// WithOpts starts from o, e.g. to mix an existing Opts with options
+func WithOpts(o Opts) Option {
+	return func(opts *Opts) { *opts = o }
+}
+
+// WithMax sets Opts.Max and Opts.MaxPolicy
+func WithMax(max int64, policy MaxPolicy) Option {
+	return func(o *Opts) {
+		o.Max = max
+		o.MaxPolicy = policy
+	}
+}
+
+// WithOverflow sets Opts.Max and Opts.Overflow
+func WithOverflow(max int64, overflow OverflowStrategy) Option {
+	return func(o *Opts) {
+		o.Max = max
+		o.Overflow = overflow
+	}
+}
+
+// WithIdleTimeout sets Opts.IdleTimeout, rounded up to the second
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *Opts) { o.IdleTimeout = int64((d + time.Second - 1) / time.Second) }
+}
+
+// WithLogger sets Opts.Logger
+func WithLogger(l Logger) Option {
+	return func(o *Opts) { o.Logger = l }
+}
+
+// WithClock sets Opts.Clock
+func WithClock(now func() time.Time) Option {
+	return func(o *Opts) { o.Clock = now }
+}
+
+// WithSweeperInterval sets Opts.CleanupInterval
+func WithSweeperInterval(d time.Duration) Option {
+	return func(o *Opts) { o.CleanupInterval = d }
+}
+
+// WithHealthCheck sets Opts.HealthCheckInterval and Opts.OnHealthCheck
+func WithHealthCheck(interval time.Duration, fn func(r *Resource, err error)) Option {
+	return func(o *Opts) {
+		o.HealthCheckInterval = interval
+		o.OnHealthCheck = fn
+	}
+}
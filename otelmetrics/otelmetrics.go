@@ -0,0 +1,126 @@
+// Package otelmetrics records the metrics of a sqlpool.Pool with
+// OpenTelemetry: acquire latencies, open durations, evictions and active
+// databases, with the driver and redacted url as attributes
+package otelmetrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/GitbookIO/go-sqlpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Attribute keys of the recorded metrics
+const (
+	DriverKey = attribute.Key("db.system")
+	UrlKey    = attribute.Key("sqlpool.url")
+	ErrorKey  = attribute.Key("error")
+)
+
+// Metrics holds the instruments recording a pool's metrics
+type Metrics struct {
+	acquires  metric.Float64Histogram
+	opens     metric.Float64Histogram
+	evictions metric.Int64Counter
+	active    metric.Int64ObservableGauge
+	idle      metric.Int64ObservableGauge
+	meter     metric.Meter
+}
+
+// New creates the instruments with meter
+func New(meter metric.Meter) (*Metrics, error) {
+	m := &Metrics{meter: meter}
+
+	var err error
+	if m.acquires, err = meter.Float64Histogram("sqlpool.acquire.duration",
+		metric.WithDescription("Time taken to acquire a database."),
+		metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.opens, err = meter.Float64Histogram("sqlpool.open.duration",
+		metric.WithDescription("Time taken to open a database."),
+		metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.evictions, err = meter.Int64Counter("sqlpool.evictions",
+		metric.WithDescription("Idle databases evicted."),
+		metric.WithUnit("{database}")); err != nil {
+		return nil, err
+	}
+	if m.active, err = meter.Int64ObservableGauge("sqlpool.databases.active",
+		metric.WithDescription("Databases with at least one user."),
+		metric.WithUnit("{database}")); err != nil {
+		return nil, err
+	}
+	if m.idle, err = meter.Int64ObservableGauge("sqlpool.databases.idle",
+		metric.WithDescription("Databases idle in the pool."),
+		metric.WithUnit("{database}")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Instrument returns opts with the hooks recording acquisitions, opens and
+// evictions, calling opts' own hooks too
+func (m *Metrics) Instrument(opts sqlpool.Opts) sqlpool.Opts {
+	onAcquire, onOpen, onEvict := opts.OnAcquire, opts.OnOpen, opts.OnEvict
+	redact := opts.Redactor
+	if redact == nil {
+		redact = sqlpool.Redact
+	}
+
+	opts.OnAcquire = func(driver, url string, wait time.Duration, err error) {
+		m.acquires.Record(context.Background(), wait.Seconds(),
+			metric.WithAttributes(append(attributes(driver, redact(url)), ErrorKey.Bool(err != nil))...))
+		if onAcquire != nil {
+			onAcquire(driver, url, wait, err)
+		}
+	}
+	opts.OnOpen = func(driver, url string, d time.Duration, err error) {
+		m.opens.Record(context.Background(), d.Seconds(),
+			metric.WithAttributes(append(attributes(driver, redact(url)), ErrorKey.Bool(err != nil))...))
+		if onOpen != nil {
+			onOpen(driver, url, d, err)
+		}
+	}
+	opts.OnEvict = func(r *sqlpool.Resource) {
+		m.evictions.Add(context.Background(), 1,
+			metric.WithAttributes(attributes(r.Driver, redact(r.Url))...))
+		if onEvict != nil {
+			onEvict(r)
+		}
+	}
+	return opts
+}
+
+// Observe reports pool's active and idle databases on every collection, until
+// the returned registration is unregistered
+func (m *Metrics) Observe(pool *sqlpool.Pool) (metric.Registration, error) {
+	return m.meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		// Count instances of the same url together, already redacted
+		type target struct{ driver, url string }
+		active, idle := map[target]int64{}, map[target]int64{}
+		for _, r := range pool.ResourceStats() {
+			t := target{r.Driver, r.Url}
+			if r.Users > 0 {
+				active[t]++
+			} else {
+				idle[t]++
+			}
+		}
+		for t, n := range active {
+			o.ObserveInt64(m.active, n, metric.WithAttributes(attributes(t.driver, t.url)...))
+		}
+		for t, n := range idle {
+			o.ObserveInt64(m.idle, n, metric.WithAttributes(attributes(t.driver, t.url)...))
+		}
+		return nil
+	}, m.active, m.idle)
+}
+
+// attributes describe a database, url must be redacted
+func attributes(driver, url string) []attribute.KeyValue {
+	return []attribute.KeyValue{DriverKey.String(driver), UrlKey.String(url)}
+}
@@ -0,0 +1,72 @@
+package otelmetrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/GitbookIO/go-sqlpool"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	m, err := New(provider.Meter("sqlpool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := sqlpool.NewPool(m.Instrument(sqlpool.Opts{
+		Max:         10,
+		IdleTimeout: 30,
+	}))
+	defer pool.Close()
+	reg, err := m.Observe(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Unregister()
+
+	url := "file:/tmp/sqlpool_test_otel.db?_auth&_auth_user=admin&password=secret"
+	if strings.Contains(sqlpool.Redact(url), "secret") {
+		t.Fatalf("Redact kept the password: %s", sqlpool.Redact(url))
+	}
+	r, err := pool.Acquire("sqlite3", url)
+	if err != nil {
+		t.Fatalf("Error opening tmp database: %s", err)
+	}
+	defer pool.Release(r)
+
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, metric := range sm.Metrics {
+			switch data := metric.Data.(type) {
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					found[metric.Name] = dp.Count == 1
+					if v, _ := dp.Attributes.Value(UrlKey); v.AsString() != sqlpool.Redact(url) {
+						t.Errorf("%s: unexpected url %q", metric.Name, v.AsString())
+					}
+				}
+			case metricdata.Gauge[int64]:
+				for _, dp := range data.DataPoints {
+					found[metric.Name] = dp.Value == 1
+				}
+			}
+		}
+	}
+	for _, name := range []string{"sqlpool.acquire.duration", "sqlpool.open.duration", "sqlpool.databases.active"} {
+		if !found[name] {
+			t.Errorf("%s not recorded", name)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package oteltrace traces the operations of a sqlpool.Pool with
+// OpenTelemetry, so slow opens and cleanups show up in the traces of the
+// requests using the pool
+package oteltrace
+
+import (
+	"context"
+
+	"github.com/GitbookIO/go-sqlpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys of the spans, alongside the ones of package otelmetrics
+const (
+	DriverKey = attribute.Key("db.system")
+	UrlKey    = attribute.Key("sqlpool.url")
+)
+
+// Trace returns an Opts.Trace starting spans named "sqlpool.<op>" with
+// tracer, use AcquireContext and ReleaseContext to trace them under a
+// request's span. Urls are redacted with redact, sqlpool.Redact if nil (pass
+// the pool's Opts.Redactor)
+func Trace(tracer trace.Tracer, redact sqlpool.Redactor) func(ctx context.Context, op, driver, url string) (context.Context, func(error)) {
+	if redact == nil {
+		redact = sqlpool.Redact
+	}
+	return func(ctx context.Context, op, driver, url string) (context.Context, func(error)) {
+		opts := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindInternal)}
+		if driver != "" {
+			opts = append(opts, trace.WithAttributes(DriverKey.String(driver), UrlKey.String(redact(url))))
+		}
+		ctx, span := tracer.Start(ctx, "sqlpool."+op, opts...)
+		return ctx, func(err error) {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+}
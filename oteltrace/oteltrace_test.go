@@ -0,0 +1,57 @@
+package oteltrace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GitbookIO/go-sqlpool"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer("sqlpool")
+
+	pool := sqlpool.NewPool(sqlpool.Opts{
+		Max:         10,
+		IdleTimeout: 30,
+		Trace:       Trace(tracer, nil),
+	})
+	defer pool.Close()
+
+	ctx, request := tracer.Start(context.Background(), "request")
+	r, err := pool.AcquireContext(ctx, "sqlite3", "/tmp/sqlpool_test_oteltrace.db")
+	if err != nil {
+		t.Fatalf("Error opening tmp database: %s", err)
+	}
+	if err := pool.ReleaseContext(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	request.End()
+
+	parents := map[string]string{}
+	ids := map[string]string{}
+	for _, s := range recorder.Ended() {
+		ids[s.SpanContext().SpanID().String()] = s.Name()
+	}
+	for _, s := range recorder.Ended() {
+		parents[s.Name()] = ids[s.Parent().SpanID().String()]
+	}
+	expected := map[string]string{
+		"request":         "",
+		"sqlpool.acquire": "request",
+		"sqlpool.open":    "sqlpool.acquire",
+		"sqlpool.release": "request",
+		"sqlpool.cleanup": "sqlpool.release",
+	}
+	for name, parent := range expected {
+		if got, ok := parents[name]; !ok || got != parent {
+			t.Errorf("Expected %s under %q, got %q (recorded: %t)", name, parent, got, ok)
+		}
+	}
+}
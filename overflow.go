@@ -0,0 +1,128 @@
+package sqlpool
+
+import (
+	"container/list"
+	"context"
+)
+
+// OverflowStrategy decides what opening a database does once the pool
+// reached Opts.Max, see Opts.Overflow. MaxPolicy values are strategies too.
+type OverflowStrategy interface {
+	// Overflow is called with the pool full, it makes room (or waits for
+	// some) and returns nil for the open to check again, or an error failing
+	// the open. It runs with the pool's lock held, so it must only use o.
+	Overflow(o *Overflow) error
+}
+
+// OverflowFunc adapts a function to an OverflowStrategy
+type OverflowFunc func(o *Overflow) error
+
+func (f OverflowFunc) Overflow(o *Overflow) error {
+	return f(o)
+}
+
+// The strategies shipped with the pool
+var (
+	// OverflowFail fails with ErrMaxCapacity
+	OverflowFail OverflowStrategy = MaxPolicyError
+	// OverflowBlock waits for a free slot, see AcquireContext to give up
+	// waiting
+	OverflowBlock OverflowStrategy = MaxPolicyBlock
+	// OverflowEvictIdle closes the least recently used idle database and
+	// proceeds, failing with ErrMaxCapacity if they're all in use
+	OverflowEvictIdle OverflowStrategy = MaxPolicyEvict
+)
+
+// Overflow is what an OverflowStrategy can do about a full pool
+type Overflow struct {
+	Driver string
+	Url    string
+
+	pool   *Pool
+	ctx    context.Context
+	ticket *list.Element // in the pool's wait queue, once waiting
+}
+
+// Wait queues the open until a database is removed from the pool and the
+// opens queued before it went, it fails with ErrPoolClosed if the pool is
+// closed meanwhile and with the acquire's context error once it's done (see
+// AcquireContext and AcquireTimeout)
+func (o *Overflow) Wait() error {
+	p := o.pool
+	if o.ticket == nil {
+		o.ticket = p.waiting.PushBack(o)
+	}
+
+	// Wake up to give up
+	stop := context.AfterFunc(o.ctx, func() {
+		p.rw.Lock()
+		defer p.rw.Unlock()
+		p.room.Broadcast()
+	})
+	defer stop()
+
+	for {
+		p.room.Wait()
+		if p.closed {
+			return ErrPoolClosed
+		}
+		if err := o.ctx.Err(); err != nil {
+			return err
+		}
+		if p.waiting.Front() == o.ticket {
+			return nil
+		}
+	}
+}
+
+// queuedBehind reports whether other opens are waiting ahead of o
+func (o *Overflow) queuedBehind() bool {
+	front := o.pool.waiting.Front()
+	return front != nil && front != o.ticket
+}
+
+// dequeue removes o from the wait queue, letting the next open in
+func (o *Overflow) dequeue() {
+	if o.ticket == nil {
+		return
+	}
+	o.pool.waiting.Remove(o.ticket)
+	o.ticket = nil
+	o.pool.room.Broadcast()
+}
+
+// EvictIdle closes the least recently used idle database, reporting whether
+// there was one
+func (o *Overflow) EvictIdle() bool {
+	return o.pool.evictLRU()
+}
+
+func (m MaxPolicy) Overflow(o *Overflow) error {
+	switch m {
+	case MaxPolicyBlock:
+		return o.Wait()
+	case MaxPolicyEvict:
+		if !o.EvictIdle() {
+			return ErrMaxCapacity
+		}
+		return nil
+	default:
+		return ErrMaxCapacity
+	}
+}
+
+// QueueDepth returns how many opens are waiting for room in the pool, see
+// Overflow.Wait
+func (p *Pool) QueueDepth() int {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+	return p.waiting.Len()
+}
+
+// overflow returns the pool's overflow strategy
+func (p *Pool) overflow() OverflowStrategy {
+	if p.opts.Overflow != nil {
+		return p.opts.Overflow
+	}
+	return p.opts.MaxPolicy
+}
@@ -0,0 +1,60 @@
+package sqlpool
+
+import (
+	"database/sql"
+	"path"
+	"time"
+)
+
+// Override adjusts the options of the databases it matches, see
+// Opts.Overrides
+type Override struct {
+	// Driver matches the driver's name exactly, Pattern matches the url
+	// like path.Match (so * doesn't match /). Empty ones match anything
+	Driver  string
+	Pattern string
+
+	// IdleTimeout replaces Opts.IdleTimeout, MaxLifetime evicts idle
+	// databases once they were opened that long ago. Zero keeps the default
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+
+	// Tune and PostInit run after Opts.Tune and Opts.PostInit
+	Tune     func(driver, url string, db *sql.DB)
+	PostInit func(driver, url string, db *sql.DB) error
+}
+
+// DriverHooks are init functions for the databases of a driver, see
+// Opts.DriverHooks
+type DriverHooks struct {
+	PreInit  func(driver, url string) error
+	Tune     func(driver, url string, db *sql.DB)
+	PostInit func(driver, url string, db *sql.DB) error
+}
+
+func (o *Override) matches(driver, url string) bool {
+	if o.Driver != "" && o.Driver != driver {
+		return false
+	}
+	if o.Pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(o.Pattern, url)
+	return ok
+}
+
+// override returns the first override matching the database, or nil
+func (p *Pool) override(driver, url string) *Override {
+	for i := range p.opts.Overrides {
+		if o := &p.opts.Overrides[i]; o.matches(driver, url) {
+			return o
+		}
+	}
+	return nil
+}
+
+// tooOld reports whether r outlived its override's MaxLifetime at now
+func (r *Resource) tooOld(now int64) bool {
+	return r.override != nil && r.override.MaxLifetime > 0 &&
+		time.Duration(now-r.openedAt) >= r.override.MaxLifetime
+}
@@ -1,47 +1,553 @@
 package sqlpool
 
 import (
+	"container/list"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"math/rand"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/GitbookIO/syncgroup"
 )
 
 type Opts struct {
+	// Max caps how many databases are open at once, what opening more does
+	// depends on Overflow, or MaxPolicy if it's nil. Zero means no limit
 	Max         int64
+	MaxPolicy   MaxPolicy
+	Overflow    OverflowStrategy
 	IdleTimeout int64
 
-	// Init functions
+	// AcquireTimeout bounds how long Acquire may take, e.g. waiting for room
+	// with MaxPolicyBlock, see Pool.AcquireTimeout. Zero waits forever
+	AcquireTimeout time.Duration
+
+	// CleanupInterval runs Cleanup in the background, so idle databases are
+	// evicted even when nothing is released. Closing the pool stops it, zero
+	// disables it
+	CleanupInterval time.Duration
+
+	// HealthCheckInterval runs HealthCheck in the background, evicting idle
+	// databases that fail a ping. OnHealthCheck gets every ping's outcome.
+	// Zero disables it
+	HealthCheckInterval time.Duration
+	OnHealthCheck       func(r *Resource, err error)
+
+	// CleanupConcurrency limits how many databases are closed at once in
+	// the background, zero means no limit
+	CleanupConcurrency int
+
+	// CloseOnZeroUsers closes databases as soon as their last user releases
+	// them instead of keeping them idle, IdleTimeout then doesn't apply
+	CloseOnZeroUsers bool
+
+	// While the pool holds more than SoftIdleTarget databases, Cleanup
+	// evicts the ones idle for longer than SoftIdleTimeout (rather than
+	// IdleTimeout) until it's back to the target. Zero disables it
+	SoftIdleTimeout time.Duration
+	SoftIdleTarget  int
+
+	// IdleGrace delays the start of the idle timeout, so resources idle
+	// between two requests of a burst don't expire. IdleObservations is how
+	// many Cleanup sweeps must find a resource expired before it's evicted,
+	// zero or one evicts it on the first
+	IdleGrace        time.Duration
+	IdleObservations int
+
+	// IdleTimeoutJitter adds a random [0, jitter) duration to each resource's
+	// idle timeout, so resources going idle together aren't all evicted (and
+	// reopened) together
+	IdleTimeoutJitter time.Duration
+
+	// Opener opens databases instead of sql.Open, e.g. to build them from a
+	// driver.Connector with sql.OpenDB, or fake ones in tests (see package
+	// sqlpooltest). Drivers then don't need to be registered with
+	// database/sql
+	Opener Opener
+
+	// OpenMiddleware wraps the sql.Open of databases, e.g. to trace, retry
+	// or resolve credentials. The first middleware is the outermost one
+	OpenMiddleware []func(next OpenFunc) OpenFunc
+
+	// Redactor removes credentials from urls before they're shown in errors,
+	// logs, events, stats, ... Defaults to Redact, which only knows common
+	// DSN formats
+	Redactor Redactor
+
+	// KeyFunc returns the form of a database's url identifying it, so that
+	// equivalent urls share a resource. It only decides that: the resource
+	// is opened with the url it was first acquired with. See NormalizeDSN.
+	// Urls are used as is by default
+	KeyFunc func(driver, url string) string
+
+	// Overrides adjust the options of the databases they match, the first
+	// match wins. E.g. a longer IdleTimeout for a hot database and a shorter
+	// one for per-tenant sqlite files
+	Overrides []Override
+
+	// Tune configures the connection pool of a database right after it's
+	// opened, before PostInit, e.g. with db.SetMaxOpenConns
+	Tune func(driver, url string, db *sql.DB)
+
+	// Init functions. When PostInit fails the database is closed and the
+	// open fails
 	PreInit  func(driver, url string) error
-	PostInit func(db *sql.DB) error
+	PostInit func(driver, url string, db *sql.DB) error
+
+	// DriverHooks are init functions by driver name, e.g. to set pragmas on
+	// sqlite3 databases only. They run after the global ones, and before the
+	// ones of Overrides
+	DriverHooks map[string]DriverHooks
+
+	// PreInitContext and PostInitContext run after PreInit and PostInit,
+	// with the context of the acquire opening the database (or Background,
+	// e.g. for Acquire and Prime): give up once it's done, e.g. to bound a
+	// migration by the request's deadline, the open then fails
+	PreInitContext  func(ctx context.Context, t Target) error
+	PostInitContext func(ctx context.Context, t Target, db *sql.DB) error
+
+	// PingOnAcquire pings databases before handing them out, ones failing
+	// the ping are dropped and reopened. With a PingIdleThreshold only the
+	// ones idle for at least that long are pinged. Databases the acquire
+	// just opened aren't
+	PingOnAcquire     bool
+	PingIdleThreshold time.Duration
+
+	// CanReuse vets an idle resource about to be acquired again, e.g. to
+	// reject old ones. When it returns false the resource is dropped and the
+	// database reopened instead, OnReuse doesn't run
+	CanReuse func(r *Resource) bool
+
+	// OnReuse runs when an idle resource is acquired again, e.g. to reset
+	// session state left over by its previous users. On error the resource
+	// is dropped and the database reopened instead. Fresh opens don't run it
+	OnReuse func(db *sql.DB) error
+
+	// VersionCheck runs once a database is opened (after PostInit) and
+	// returns the server's version, available as Resource.ServerVersion. An
+	// error, e.g. for a server that's too old, fails the open
+	VersionCheck func(db *sql.DB) (string, error)
+
+	// WarnOnLeakedClose makes Close, ForceClose, CloseContext and
+	// CloseTimeout report the resources still acquired when they're called,
+	// a sign of missing releases, in an error wrapping ErrLeaked. They're
+	// closed all the same. Shutdown reports the ones still acquired once its
+	// context is done
+	WarnOnLeakedClose bool
+
+	// CloseTimeout bounds how long closing an evicted database may take, a
+	// close still hanging then is abandoned (freeing its CleanupConcurrency
+	// slot) and reported to OnStuckClose. Zero waits forever
+	CloseTimeout time.Duration
+	OnStuckClose func(r *Resource)
+
+	// OnAcquire is called with how long every acquisition took and its
+	// error, if it failed. OnOpen is called with how long opening a database took, from
+	// PreInit to VersionCheck, and its error. OnEvict is called with idle
+	// databases evicted by Cleanup, MaxPolicyEvict or HealthCheck, OnClose
+	// once any database is closed and OnRelease after every release. See
+	// also Pool.Events
+	OnAcquire func(driver, url string, wait time.Duration, err error)
+	OnOpen    func(driver, url string, d time.Duration, err error)
+	OnEvict   func(r *Resource)
+	OnClose   func(r *Resource, err error)
+	OnRelease func(r *Resource)
+
+	// Clock tells the time for idle timeouts and stats, defaults to time.Now
+	Clock func() time.Time
+
+	// Logger receives failed opens and closes, evictions and failed health
+	// checks. Nothing is logged by default
+	Logger Logger
+
+	// Trace starts a span for an operation of the pool ("acquire",
+	// "release", "open" or "cleanup", without driver and url), returning
+	// the span's context and a function ending it with the operation's
+	// error. Opens are traced under the acquire that triggered them, and
+	// OpenMiddleware gets the open's context. See package oteltrace
+	Trace func(ctx context.Context, op, driver, url string) (context.Context, func(err error))
+
+	// OnIdleEnd is called when an idle resource is acquired again
+	// (reused=true), or evicted or discarded on reuse (see CanReuse), with how
+	// long it was idle
+	OnIdleEnd func(r *Resource, idleFor time.Duration, reused bool)
+
+	// OnCleanup is called at the end of every Cleanup sweep with the number
+	// of inactive resources examined, how many were evicted and how long
+	// the (locked) scan took. Closing evicted databases is not included.
+	OnCleanup func(examined, evicted int, duration time.Duration)
+
+	// IsWrite classifies statements run through Resource.ExecContext, writes
+	// are rejected on read-only resources. Defaults to matching a leading
+	// INSERT, UPDATE or DELETE
+	IsWrite func(query string) bool
+
+	// OnStateChange is called when a resource gains its first user
+	// (active=true) or loses its last one (active=false)
+	OnStateChange func(r *Resource, active bool)
+
+	// StmtCacheSize bounds how many statements Resource.PreparedContext
+	// keeps prepared per resource, zero means unbounded
+	StmtCacheSize int
+
+	// OnSlowOpen is called when opening a database, from PreInit to
+	// PostInit, takes longer than SlowOpenThreshold
+	SlowOpenThreshold time.Duration
+	OnSlowOpen        func(key string, d time.Duration)
+
+	// GroupFor assigns databases to groups, MaxPerGroup caps how many
+	// databases of a group can be open at once: opening more fails with
+	// ErrGroupFull. Groups missing from MaxPerGroup aren't limited
+	GroupFor    func(driver, url string) string
+	MaxPerGroup map[string]int
+
+	// OnLimit is called with the key of a database that can't be opened
+	// right away because the pool reached Max, before the overflow strategy
+	// (see Overflow) fails, waits or evicts. It's called once per open
+	OnLimit func(key string)
+
+	// MaxUsersFor returns how many users may share a database at once, when
+	// all its instances are saturated another one is opened. Zero (or a nil
+	// MaxUsersFor) means unlimited sharing
+	MaxUsersFor func(driver, url string) int
+
+	// FanoutRespectsMax keeps overflow instances from taking the pool past
+	// Max: once it's full, saturated instances are shared beyond their
+	// MaxUsersFor, queueing at the driver instead. This favors a bounded
+	// connection count over latency. By default overflow instances are
+	// opened regardless of Max
+	FanoutRespectsMax bool
+
+	// A resource's breaker trips after BreakerThreshold consecutive query
+	// failures (see Resource.ExecContext), acquiring it then fails with
+	// ErrResourceUnavailable for BreakerCooldown. A single probe acquisition
+	// is let through afterwards, and another one every BreakerCooldown until
+	// a query's outcome closes or re-trips the breaker. Zero disables the
+	// breaker
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// ReconnectBackoff holds off reopening a database after it failed to
+	// open: acquiring it fails with ErrResourceDown until the backoff is
+	// over, then a single acquire retries. A zero Min disables it
+	ReconnectBackoff Backoff
+
+	// WaitBuckets are the upper bounds of WaitHistogram's buckets, they
+	// default to DefaultWaitBuckets
+	WaitBuckets []time.Duration
+
+	// MaxConcurrentOpens limits how many databases are opened at once, it
+	// also sets how many are primed in parallel. Zero means no limit
+	MaxConcurrentOpens int
 }
 
+// MaxPolicy is what opening a database does once the pool reached Opts.Max
+type MaxPolicy int
+
+const (
+	// Fail with ErrPoolFull
+	MaxPolicyError MaxPolicy = iota
+	// Wait for a database to be removed from the pool, see AcquireContext
+	// to give up waiting
+	MaxPolicyBlock
+	// Close the least recently used idle database, failing with ErrPoolFull
+	// if they're all in use
+	MaxPolicyEvict
+)
+
+// OpenFunc opens a database, see Opts.OpenMiddleware
+type OpenFunc func(ctx context.Context, driver, url string) (*sql.DB, error)
+
 type Pool struct {
+	// Counters, updated atomically (keep first for 64-bit alignment)
+	hits           int64
+	opens          int64
+	openWaits      int64
+	primed         int64
+	openErrs       int64
+	healthChecks   int64
+	healthFailures int64
+	acquires       int64
+	releases       int64
+	evictions      int64
+	inFlight       int64   // acquisitions not yet released
+	waits          []int64 // per bucket of waitBuckets, plus an overflow one
+
 	opts Opts
 	rw   sync.RWMutex
 
-	databases map[string]*Resource
-	inactive  map[string]*Resource
-	conds     *syncgroup.CondGroup
+	databases   map[string]*Resource   // by id
+	inactive    map[string]*Resource   // by id
+	idle        *list.List             // inactive, least recently used first
+	waiting     *list.List             // opens waiting for room, see Overflow.Wait
+	instances   map[string][]*Resource // by key
+	readOnly    map[string]bool
+	draining    map[string]bool       // by driver
+	reconnects  map[string]*reconnect // failed opens, by key
+	opening     map[string]*opening   // by open lock
+	history     *openHistory
+	conds       *syncgroup.CondGroup
+	openSlots   chan struct{} // nil when opens aren't limited
+	closeSlots  chan struct{} // nil when closes aren't limited
+	waitBuckets []time.Duration
+	openFunc    OpenFunc                    // openBase wrapped in Opts.OpenMiddleware
+	connectors  map[string]driver.Connector // by name, see AcquireConnector
+	log         Logger
+
+	closed   bool
+	drained  bool           // see Drain
+	reserved int            // databases being opened
+	room     *sync.Cond     // signaled when databases are removed, on rw
+	groups   map[string]int // databases per group, including reserved ones
+
+	subscribers subscribers // see Events
+
+	// Background sweeper and health checker, see Opts.CleanupInterval and
+	// Opts.HealthCheckInterval
+	stopSweeper context.CancelFunc
+	sweeper     sync.WaitGroup
+
+	// Canceled to shut the pool down, see NewPoolWithContext
+	parent context.Context
+
+	// Clock, overridable in tests
+	now func() time.Time
 }
 
 type Stats struct {
+	// Databases open: those with at least one user, idle ones and idle ones
+	// kept by Pin
 	Total    int
 	Active   int
 	Inactive int
+	Pinned   int
+
+	// How acquisitions found their database: already open, opened by the
+	// acquirer itself or by waiting on a concurrent open of the same key
+	Hits      int64
+	Opens     int64
+	OpenWaits int64
+
+	// Opens that failed, from PreInit to VersionCheck
+	OpenErrors int64
+
+	// Successful acquisitions and releases, and idle databases evicted by
+	// Cleanup, MaxPolicyEvict or HealthCheck
+	Acquires  int64
+	Releases  int64
+	Evictions int64
+
+	// Idle databases pinged by HealthCheck, and how many failed
+	HealthChecks   int64
+	HealthFailures int64
+
+	// Databases opened and pinged in the background by Prime
+	Primed int64
+
+	// Databases open per group, when Opts.GroupFor is set
+	Groups map[string]int
+
+	// Every resource, as returned by ResourceStats, and the sum of their
+	// sql.DBStats. Only Stats fills them in
+	PerDatabase []ResourceStats
+	DBStats     sql.DBStats
 }
 
 func NewPool(opts Opts) *Pool {
-	return &Pool{
-		opts:      opts,
-		rw:        sync.RWMutex{},
-		databases: map[string]*Resource{},
-		inactive:  map[string]*Resource{},
-		conds:     syncgroup.NewCondGroup(),
+	return newPool(context.Background(), opts)
+}
+
+// NewPoolWithContext is like NewPool but binds the pool to ctx: once ctx is
+// canceled the sweeper and health checker stop, pending opens are canceled
+// (see Opts.PreInitContext) and the pool shuts down gracefully, see Shutdown.
+// Reopening it then doesn't restart its sweeper and health checker
+func NewPoolWithContext(ctx context.Context, opts Opts) *Pool {
+	p := newPool(ctx, opts)
+	context.AfterFunc(ctx, func() {
+		p.Shutdown(context.Background())
+	})
+	return p
+}
+
+func newPool(ctx context.Context, opts Opts) *Pool {
+	var openSlots chan struct{}
+	if opts.MaxConcurrentOpens > 0 {
+		openSlots = make(chan struct{}, opts.MaxConcurrentOpens)
+	}
+
+	var closeSlots chan struct{}
+	if opts.CleanupConcurrency > 0 {
+		closeSlots = make(chan struct{}, opts.CleanupConcurrency)
+	}
+
+	waitBuckets := append([]time.Duration{}, opts.WaitBuckets...)
+	if len(waitBuckets) == 0 {
+		waitBuckets = DefaultWaitBuckets
+	}
+	sort.Slice(waitBuckets, func(i, j int) bool { return waitBuckets[i] < waitBuckets[j] })
+
+	var log Logger = nopLogger{}
+	if opts.Logger != nil {
+		log = opts.Logger
+	}
+
+	p := &Pool{
+		opts:       opts,
+		rw:         sync.RWMutex{},
+		databases:  map[string]*Resource{},
+		inactive:   map[string]*Resource{},
+		idle:       list.New(),
+		waiting:    list.New(),
+		instances:  map[string][]*Resource{},
+		groups:     map[string]int{},
+		readOnly:   map[string]bool{},
+		draining:   map[string]bool{},
+		reconnects: map[string]*reconnect{},
+		opening:    map[string]*opening{},
+		history:    newOpenHistory(),
+		conds:      syncgroup.NewCondGroup(),
+		openSlots:  openSlots,
+		closeSlots: closeSlots,
+		connectors: map[string]driver.Connector{},
+		log:        log,
+
+		waits:       make([]int64, len(waitBuckets)+1),
+		waitBuckets: waitBuckets,
+		parent:      ctx,
+		now:         time.Now,
+	}
+	if opts.Clock != nil {
+		p.now = opts.Clock
+	}
+	p.room = sync.NewCond(&p.rw)
+
+	p.openFunc = p.openBase
+	for i := len(opts.OpenMiddleware) - 1; i >= 0; i-- {
+		p.openFunc = opts.OpenMiddleware[i](p.openFunc)
+	}
+
+	p.startSweeping()
+	return p
+}
+
+// startSweeping starts the background sweeper, if any, it must be called
+// with the lock held or before the pool is shared
+func (p *Pool) startSweeping() {
+	ctx, cancel := context.WithCancel(p.parent)
+	p.stopSweeper = cancel
+	if p.opts.CleanupInterval > 0 {
+		p.sweeper.Add(1)
+		go p.sweep(ctx, p.opts.CleanupInterval)
+	}
+	if p.opts.HealthCheckInterval > 0 {
+		p.sweeper.Add(1)
+		go p.checkHealth(ctx, p.opts.HealthCheckInterval)
+	}
+}
+
+// sweep runs Cleanup every interval until ctx is done
+func (p *Pool) sweep(ctx context.Context, interval time.Duration) {
+	defer p.sweeper.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.CleanupContext(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stopSweeping stops the background sweeper, interrupting its current sweep,
+// and waits for it to exit
+func (p *Pool) stopSweeping() {
+	p.rw.RLock()
+	stop := p.stopSweeper
+	p.rw.RUnlock()
+
+	stop()
+	p.sweeper.Wait()
+}
+
+// NewPoolWithValidation is like NewPool but rejects invalid options
+func NewPoolWithValidation(opts Opts) (*Pool, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return NewPool(opts), nil
+}
+
+// Validate checks the options' invariants, the returned error lists every
+// one that doesn't hold
+func (o Opts) Validate() error {
+	problems := []string{}
+	if o.Max < 0 {
+		problems = append(problems, "Max must be >= 0")
+	}
+	if o.MaxPolicy < MaxPolicyError || o.MaxPolicy > MaxPolicyEvict {
+		problems = append(problems, "MaxPolicy is unknown")
+	}
+	if o.IdleTimeout < 0 {
+		problems = append(problems, "IdleTimeout must be >= 0")
 	}
+	if o.AcquireTimeout < 0 {
+		problems = append(problems, "AcquireTimeout must be >= 0")
+	}
+	if o.IdleTimeoutJitter < 0 {
+		problems = append(problems, "IdleTimeoutJitter must be >= 0")
+	}
+	if o.BreakerThreshold < 0 {
+		problems = append(problems, "BreakerThreshold must be >= 0")
+	}
+	if o.CleanupInterval < 0 {
+		problems = append(problems, "CleanupInterval must be >= 0")
+	}
+	if o.HealthCheckInterval < 0 {
+		problems = append(problems, "HealthCheckInterval must be >= 0")
+	}
+	if o.CleanupConcurrency < 0 {
+		problems = append(problems, "CleanupConcurrency must be >= 0")
+	}
+	if o.MaxConcurrentOpens < 0 {
+		problems = append(problems, "MaxConcurrentOpens must be >= 0")
+	}
+	if o.IdleGrace < 0 {
+		problems = append(problems, "IdleGrace must be >= 0")
+	}
+	if o.IdleObservations < 0 {
+		problems = append(problems, "IdleObservations must be >= 0")
+	}
+	if o.SoftIdleTarget < 0 {
+		problems = append(problems, "SoftIdleTarget must be >= 0")
+	}
+	if o.StmtCacheSize < 0 {
+		problems = append(problems, "StmtCacheSize must be >= 0")
+	}
+	if o.ReconnectBackoff.Max > 0 && o.ReconnectBackoff.Max < o.ReconnectBackoff.Min {
+		problems = append(problems, "ReconnectBackoff.Max must be >= ReconnectBackoff.Min")
+	}
+	for i, ov := range o.Overrides {
+		if _, err := path.Match(ov.Pattern, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("Overrides[%d].Pattern is malformed", i))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid pool options: %s", strings.Join(problems, "; "))
+	}
+	return nil
 }
 
 // What our Pool tracks
@@ -50,185 +556,1387 @@ type Resource struct {
 	Driver string
 	Url    string
 
+	pool   *Pool
+	keyUrl string // see Opts.KeyFunc
+
 	// Private fields used to track resource usage
-	users      syncgroup.ActiveCounter
-	lastActive int64
+	readOnly    int32
+	failures    int32 // consecutive query failures
+	trippedAt   int64 // UnixNano, when the breaker last tripped
+	probedAt    int64 // UnixNano, when the half-open breaker last let through
+	users       syncgroup.ActiveCounter
+	lastActive  int64 // UnixNano
+	openedAt    int64 // UnixNano
+	idleTimeout time.Duration
+	idleElem    *list.Element // in the pool's LRU list, while idle
+	idleSweeps  int           // Cleanup sweeps that found it expired
+	acquires    int64         // on the pool's lock
+	override    *Override
+	pinned      bool
+	retired     bool // closed by its last user
+	instance    int  // see Opts.MaxUsersFor
+	group       string
+	version     string
+
+	stmts *stmtCache
 }
 
+// Key returns the resource's key, the same as Pool.Key(r.Driver, r.Url)
 func (r *Resource) Key() string {
-	return key(r.Driver, r.Url)
+	return key(r.Driver, r.keyUrl)
 }
 
-func (p *Pool) Acquire(driver, url string) (*Resource, error) {
-	// Actually get resource
-	resource, err := p.open(driver, url)
-	if err != nil {
-		return nil, err
-	} else if resource == nil {
-		return nil, fmt.Errorf("Failed to open %s://%s for an unknown reason", driver, url)
-	}
-
-	// Update resource's usage
-	p.acquire(resource)
+// ServerVersion returns the version reported by Opts.VersionCheck
+func (r *Resource) ServerVersion() string {
+	return r.version
+}
 
-	return resource, nil
+// Instance numbers the resource among the instances of its database: the
+// primary one is 0 and overflow instances, opened once the others are
+// saturated (see Opts.MaxUsersFor), get the lowest number free. All instances
+// share the same Key()
+func (r *Resource) Instance() int {
+	return r.instance
 }
 
-func (p *Pool) Release(r *Resource) error {
-	// Update resource's usage
-	p.release(r)
+// IsOverflow reports whether the resource is an extra instance of its
+// database, opened because the others were saturated
+func (r *Resource) IsOverflow() bool {
+	return r.instance > 0
+}
 
-	// Mark as idle
-	if !r.users.IsActive() {
-		p.rw.Lock()
-		p.inactive[r.Key()] = r
-		p.rw.Unlock()
+// redactedKey is r's key without credentials, for logs and stats
+func (r *Resource) redactedKey() string {
+	return key(r.Driver, r.pool.redact(r.keyUrl))
+}
 
-		// Do cleanup
-		// TODO: lazily
-		return p.Cleanup()
+// Release releases r to the pool it was acquired from, like Pool.Release
+func (r *Resource) Release() error {
+	if r.pool == nil {
+		return ErrResourceNotManaged
 	}
+	return r.pool.Release(r)
+}
 
-	return nil
+// Close releases r, it doesn't close the database: it makes Resource an
+// io.Closer, e.g. for defer r.Close()
+func (r *Resource) Close() error {
+	return r.Release()
 }
 
-func (p *Pool) Close() error {
-	return p.close(false)
+// id identifies the resource among the instances of its key
+func (r *Resource) id() string {
+	return instanceKey(r.Driver, r.keyUrl, r.instance)
 }
 
-func (p *Pool) ForceClose() error {
-	return p.close(true)
+// close closes the resource's database and cached statements
+func (r *Resource) close() error {
+	r.stmts.clear()
+	return r.DB.Close()
 }
 
-func (p *Pool) close(force bool) error {
-	p.rw.Lock()
-	defer p.rw.Unlock()
+// Target identifies a database to acquire
+type Target struct {
+	Driver string
+	Url    string
+}
 
-	for key, resource := range p.databases {
-		// Exit if we're not force closing
-		if err := resource.DB.Close(); err != nil && !force {
-			return err
-		}
-		p.removeResource(key)
+func (t Target) Key() string {
+	return key(t.Driver, t.Url)
+}
+
+func (p *Pool) Acquire(driver, url string) (*Resource, error) {
+	if p.opts.AcquireTimeout > 0 {
+		return p.AcquireTimeout(driver, url, p.opts.AcquireTimeout)
 	}
 
-	return nil
+	start := time.Now()
+
+	ctx, end := p.trace(context.Background(), "acquire", driver, url)
+	r, err := p.take(ctx, driver, url)
+	end(err)
+	p.observeWait(driver, url, start, err)
+	return r, err
 }
 
-// Cleanup removes old/inactive connections
-func (p *Pool) Cleanup() error {
-	// Write lock
-	p.rw.Lock()
-	defer p.rw.Unlock()
+// take acquires the database, opening it if needed
+func (p *Pool) take(ctx context.Context, driver, url string) (*Resource, error) {
+	for {
+		if err := p.drainError(driver); err != nil {
+			return nil, err
+		}
 
-	// Current timestamp
-	now := time.Now().Unix()
+		// Actually get resource
+		resource, err := p.open(ctx, driver, url)
+		if err != nil {
+			return nil, err
+		} else if resource == nil {
+			return nil, p.openError(driver, url, errUnknownReason)
+		}
 
-	for key, resource := range p.inactive {
-		// Skip if still valid
-		if (now - p.opts.IdleTimeout) < resource.lastActive {
-			continue
+		if !resource.admit() {
+			return nil, ErrResourceUnavailable
 		}
 
-		// Remove from inactive list and databases
-		delete(p.databases, key)
-		delete(p.inactive, key)
+		// Update resource's usage, unless it was evicted in the meantime
+		if p.acquire(resource) {
+			return resource, nil
+		}
+	}
+}
 
-		// Close database
-		go func(r *Resource) {
-			p.cleanupResource(r)
-		}(resource)
+// AcquireAll acquires every target or none of them. Targets are acquired in
+// key order so concurrent callers can't deadlock each other, resources are
+// returned in the order of targets
+func (p *Pool) AcquireAll(targets []Target) ([]*Resource, error) {
+	order := make([]int, len(targets))
+	for i := range order {
+		order[i] = i
 	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return targets[order[a]].Key() < targets[order[b]].Key()
+	})
 
-	return nil
+	resources := make([]*Resource, len(targets))
+	for _, i := range order {
+		resource, err := p.Acquire(targets[i].Driver, targets[i].Url)
+		if err != nil {
+			// Give back what we already hold
+			for _, r := range resources {
+				if r != nil {
+					p.Release(r)
+				}
+			}
+			return nil, err
+		}
+		resources[i] = resource
+	}
+
+	return resources, nil
 }
 
-func (p *Pool) Stats() Stats {
-	total := len(p.databases)
-	inactive := len(p.inactive)
-	active := total - inactive
+// Release hands r back to the pool. It fails with ErrResourceNotManaged if r
+// doesn't belong to the pool (anymore), and ErrDoubleRelease if it's
+// released more than it was acquired
+func (p *Pool) Release(r *Resource) error {
+	return p.ReleaseContext(context.Background(), r)
+}
 
-	return Stats{
-		Total:    total,
-		Active:   active,
-		Inactive: inactive,
+// ReleaseStats releases r and returns the pool's stats as of the release,
+// taken under the same lock. The cleanup sweep following the release isn't
+// reflected in them.
+func (p *Pool) ReleaseStats(r *Resource) (Stats, error) {
+	var stats Stats
+	idle, err := p.release(r, &stats)
+	if err != nil {
+		return stats, err
 	}
+	p.released(r)
+	if idle {
+		return stats, p.Cleanup()
+	}
+	return stats, nil
 }
 
-func (p *Pool) cleanupResource(r *Resource) {
-	// Close database
-	if err := r.DB.Close(); err != nil {
-		// TODO: log failure
+func (p *Pool) releaseResource(ctx context.Context, r *Resource) error {
+	// Update resource's usage
+	idle, err := p.release(r, nil)
+	if err != nil {
+		return err
 	}
+	p.released(r)
+	if idle {
+		// Do cleanup
+		// TODO: lazily
+		return p.CleanupContext(ctx)
+	}
+
+	return nil
 }
 
-func (p *Pool) acquire(r *Resource) {
-	r.users.Inc()
-	r.lastActive = time.Now().Unix()
+// Pin keeps r open while it is idle, until it is unpinned
+func (p *Pool) Pin(r *Resource) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	r.pinned = true
+	p.unsetIdle(r)
 }
 
-func (p *Pool) release(r *Resource) {
-	r.users.Dec()
-	r.lastActive = time.Now().Unix()
+// Unpin makes r eligible for idle eviction again
+func (p *Pool) Unpin(r *Resource) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	r.pinned = false
+	if !r.users.IsActive() && p.databases[r.id()] == r {
+		r.idleTimeout = p.idleTimeout(r)
+		p.setIdle(r)
+	}
+}
+
+// Touch resets r's idle timer without using it, pushing back its eviction
+func (p *Pool) Touch(r *Resource) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	r.lastActive = p.now().UnixNano()
+	if p.inactive[r.id()] == r {
+		p.setIdle(r)
+	}
 }
 
-func (p *Pool) open(driver, url string) (*Resource, error) {
-	// DB already opened
-	if p.has(driver, url) {
-		return p.get(driver, url), nil
+// Peek returns the database's resource if it's open, without acquiring it or
+// opening the database. It's for inspection only: don't run queries on it,
+// nothing keeps it from being closed meanwhile
+func (p *Pool) Peek(driver, url string) (*Resource, bool) {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	if instances := p.instances[p.keyOf(driver, url)]; len(instances) > 0 {
+		return instances[0], true
 	}
+	return nil, false
+}
 
-	// Open DB: only one should do this, everyone else should wait
-	if p.conds.Lock(key("open", driver, url)) {
-		defer p.conds.Unlock(key("open", driver, url))
-		// Before opening DB
-		if p.opts.PreInit != nil {
-			if err := p.opts.PreInit(driver, url); err != nil {
-				return nil, err
-			}
+// CloseIfIdle closes and removes the database only if nobody is using it,
+// reporting whether it did so
+func (p *Pool) CloseIfIdle(driver, url string) (bool, error) {
+	p.rw.Lock()
+	resources := append([]*Resource{}, p.instances[p.keyOf(driver, url)]...)
+	for _, r := range resources {
+		if r.users.IsActive() {
+			p.rw.Unlock()
+			return false, nil
 		}
+	}
+	for _, r := range resources {
+		p.removeResource(r.id())
+	}
+	p.rw.Unlock()
 
-		// Open DB
-		db, err := sql.Open(driver, url)
-		if err != nil {
-			return nil, err
+	var errs []error
+	for _, r := range resources {
+		if err := p.closeResource(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(resources) > 0, errors.Join(errs...)
+}
+
+// Consolidate closes the idle extra instances of a database opened to share
+// out its users (see Opts.MaxUsersFor), keeping as many as its current users
+// need and at least one. Instances in use are never closed, and overflow
+// instances (see Resource.IsOverflow) go before the primary one
+func (p *Pool) Consolidate(driver, url string) error {
+	p.rw.Lock()
+	resources := append([]*Resource{}, p.instances[p.keyOf(driver, url)]...)
+	sort.Slice(resources, func(i, j int) bool { return resources[i].instance < resources[j].instance })
+
+	// How many instances the current users need
+	var users int64
+	kept := 0
+	for _, r := range resources {
+		users += r.users.Get()
+		if r.users.IsActive() || r.pinned {
+			kept++
 		}
+	}
+	needed := 1
+	if max := int64(p.maxUsers(driver, url)); max > 0 && users > max {
+		needed = int((users + max - 1) / max)
+	}
 
-		// After opening DB
-		if p.opts.PostInit != nil {
-			if err := p.opts.PostInit(db); err != nil {
-				return nil, err
-			}
+	// Close the idle ones beyond that, keeping the lowest instances
+	closing := []*Resource{}
+	for _, r := range resources {
+		if r.users.IsActive() || r.pinned {
+			continue
 		}
+		if kept < needed {
+			kept++
+			continue
+		}
+		p.removeResource(r.id())
+		closing = append(closing, r)
+	}
+	p.rw.Unlock()
 
-		// Add db resource
-		p.rw.Lock()
-		p.databases[key(driver, url)] = &Resource{
-			DB:     db,
-			Driver: driver,
-			Url:    url,
+	var errs []error
+	for _, r := range closing {
+		if err := p.closeResource(r); err != nil {
+			errs = append(errs, err)
 		}
-		p.rw.Unlock()
 	}
+	return errors.Join(errs...)
+}
 
-	return p.get(driver, url), nil
+func (p *Pool) Close() error {
+	return p.close(false)
 }
 
-func (p *Pool) removeResource(key string) {
-	delete(p.databases, key)
-	delete(p.inactive, key)
+func (p *Pool) ForceClose() error {
+	return p.close(true)
 }
 
-func (p *Pool) get(driver, url string) *Resource {
-	p.rw.RLock()
-	defer p.rw.RUnlock()
-	return p.databases[key(driver, url)]
+// Reopen makes a closed pool usable again, and ends its drain mode (see
+// Drain), acquisitions fail with ErrPoolClosed in the meantime. It's a no-op
+// on an open pool
+func (p *Pool) Reopen() {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	if !p.closed {
+		return
+	}
+	p.closed = false
+	p.drained = false
+	p.startSweeping()
+	p.reopenEvents()
 }
 
-func (p *Pool) has(driver, url string) bool {
-	return p.get(driver, url) != nil
+// CloseTimeout closes every database like Close, giving each one perResource
+// to close: the ones that don't make it are abandoned and reported in the
+// returned error, along with close errors.
+func (p *Pool) CloseTimeout(perResource time.Duration) error {
+	resources := p.detachAll()
+	defer p.closeEvents()
+
+	errs := []error{p.leaked(resources)}
+	results := make(chan error, len(resources))
+	for _, r := range resources {
+		go func(r *Resource) {
+			results <- p.closeWithin(r, perResource)
+		}(r)
+	}
+
+	for range resources {
+		errs = append(errs, <-results)
+	}
+	return errors.Join(errs...)
 }
 
-func key(strs ...string) string {
-	return strings.Join(strs, ":")
+// detachAll closes the pool and removes all its resources, in use or not,
+// stopping the sweeper. The resources are returned for closing
+func (p *Pool) detachAll() []*Resource {
+	p.stopSweeping()
+
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	p.closed = true
+	resources := make([]*Resource, 0, len(p.databases))
+	for id, r := range p.databases {
+		resources = append(resources, r)
+		p.removeResource(id)
+	}
+	return resources
+}
+
+// closeWithin closes r, giving up after timeout
+func (p *Pool) closeWithin(r *Resource, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- p.closeResource(r)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("Timed out closing %s after %s: %w", r.redactedKey(), timeout, ErrCloseTimeout)
+	}
+}
+
+func (p *Pool) close(force bool) error {
+	p.stopSweeping()
+
+	// Report closes once unlocked
+	type closed struct {
+		r   *Resource
+		err error
+	}
+	closes := []closed{}
+	defer func() {
+		for _, c := range closes {
+			p.closedResource(c.r, c.err)
+		}
+		p.closeEvents()
+	}()
+
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	p.closed = true
+
+	// Report resources closed under their users' feet
+	resources := make([]*Resource, 0, len(p.databases))
+	for _, r := range p.databases {
+		resources = append(resources, r)
+	}
+	leaked := p.leaked(resources)
+
+	for _, resource := range resources {
+		// Exit if we're not force closing
+		err := resource.close()
+		closes = append(closes, closed{resource, err})
+		if err != nil && !force {
+			return errors.Join(leaked, err)
+		}
+		p.removeResource(resource.id())
+	}
+
+	return leaked
+}
+
+// leaked describes the resources still in use, if Opts.WarnOnLeakedClose
+func (p *Pool) leaked(resources []*Resource) error {
+	if !p.opts.WarnOnLeakedClose {
+		return nil
+	}
+
+	leaks := []string{}
+	for _, r := range resources {
+		if users := r.users.Get(); users > 0 {
+			leaks = append(leaks, fmt.Sprintf("%s (%d users)", r.redactedKey(), users))
+		}
+	}
+	if len(leaks) == 0 {
+		return nil
+	}
+	sort.Strings(leaks)
+	return fmt.Errorf("%w: %s", ErrLeaked, strings.Join(leaks, ", "))
+}
+
+// Cleanup removes old/inactive connections
+func (p *Pool) Cleanup() error {
+	return p.CleanupContext(context.Background())
+}
+
+// CleanupContext is like Cleanup but stops sweeping once ctx is done, e.g. on
+// shutdown, returning ctx's error. Resources evicted so far are still closed,
+// the next sweep picks up the rest
+func (p *Pool) CleanupContext(ctx context.Context) error {
+	ctx, end := p.trace(ctx, "cleanup", "", "")
+	err := p.cleanup(ctx)
+	end(err)
+	return err
+}
+
+func (p *Pool) cleanup(ctx context.Context) error {
+	// Write lock
+	p.rw.Lock()
+	start := time.Now()
+
+	// Current timestamp
+	now := p.now().UnixNano()
+
+	examined := 0
+	evicted := []*Resource{}
+	idleFor := []time.Duration{}
+	total := len(p.databases)
+	var err error
+	for key, resource := range p.inactive {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		examined++
+
+		// Shorter timeout while the pool is over its soft target
+		timeout := resource.idleTimeout
+		if p.opts.SoftIdleTarget > 0 && total > p.opts.SoftIdleTarget && p.opts.SoftIdleTimeout < timeout {
+			timeout = p.opts.SoftIdleTimeout
+		}
+
+		// Skip if still valid
+		if time.Duration(now-resource.lastActive) < p.opts.IdleGrace+timeout && !resource.tooOld(now) {
+			continue
+		}
+
+		// Wait for enough sweeps to agree
+		if resource.idleSweeps++; resource.idleSweeps < p.opts.IdleObservations {
+			continue
+		}
+
+		// Remove from inactive list and databases
+		p.removeResource(key)
+		evicted = append(evicted, resource)
+		idleFor = append(idleFor, time.Duration(now-resource.lastActive))
+		total--
+	}
+
+	duration := time.Since(start)
+	atomic.AddInt64(&p.evictions, int64(len(evicted)))
+	p.rw.Unlock()
+
+	for i, r := range evicted {
+		p.evicted(r)
+		p.idleEnded(r, idleFor[i], false)
+	}
+
+	// Close databases
+	p.cleanupResources(evicted)
+
+	if p.opts.OnCleanup != nil {
+		p.opts.OnCleanup(examined, len(evicted), duration)
+	}
+
+	return err
+}
+
+// InFlight returns how many acquisitions haven't been released yet, it's a
+// single atomic read and cheap enough to sample often
+func (p *Pool) InFlight() int {
+	return int(atomic.LoadInt64(&p.inFlight))
+}
+
+func (p *Pool) Stats() Stats {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	stats := p.stats()
+	stats.PerDatabase = p.resourceStats()
+	for _, r := range stats.PerDatabase {
+		stats.DBStats = addDBStats(stats.DBStats, r.DBStats)
+	}
+	return stats
+}
+
+// stats must be called with the lock held
+func (p *Pool) stats() Stats {
+	total := len(p.databases)
+	inactive := len(p.inactive)
+	active := 0
+	for _, r := range p.databases {
+		if r.users.IsActive() {
+			active++
+		}
+	}
+
+	var groups map[string]int
+	if p.opts.GroupFor != nil {
+		groups = map[string]int{}
+		for _, r := range p.databases {
+			groups[r.group]++
+		}
+	}
+
+	return Stats{
+		Total:    total,
+		Active:   active,
+		Inactive: inactive,
+		Pinned:   total - active - inactive,
+
+		Hits:      atomic.LoadInt64(&p.hits),
+		Opens:     atomic.LoadInt64(&p.opens),
+		OpenWaits: atomic.LoadInt64(&p.openWaits),
+
+		OpenErrors: atomic.LoadInt64(&p.openErrs),
+
+		Acquires:  atomic.LoadInt64(&p.acquires),
+		Releases:  atomic.LoadInt64(&p.releases),
+		Evictions: atomic.LoadInt64(&p.evictions),
+
+		HealthChecks:   atomic.LoadInt64(&p.healthChecks),
+		HealthFailures: atomic.LoadInt64(&p.healthFailures),
+
+		Primed: atomic.LoadInt64(&p.primed),
+		Groups: groups,
+	}
+}
+
+// cleanupResources closes resources in the background
+func (p *Pool) cleanupResources(resources []*Resource) {
+	workers := len(resources)
+	if n := p.opts.CleanupConcurrency; n > 0 && n < workers {
+		workers = n
+	}
+
+	queue := make(chan *Resource, len(resources))
+	for _, r := range resources {
+		queue <- r
+	}
+	close(queue)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for r := range queue {
+				p.cleanupResource(r)
+			}
+		}()
+	}
+}
+
+func (p *Pool) cleanupResource(r *Resource) {
+	// Wait for a close slot
+	if p.closeSlots != nil {
+		p.closeSlots <- struct{}{}
+		defer func() { <-p.closeSlots }()
+	}
+
+	// Close database, abandoning it if it hangs
+	if p.opts.CloseTimeout > 0 {
+		err := p.closeWithin(r, p.opts.CloseTimeout)
+		if errors.Is(err, ErrCloseTimeout) {
+			p.log.Warn("Gave up closing database", "db", r.redactedKey(), "timeout", p.opts.CloseTimeout)
+			if p.opts.OnStuckClose != nil {
+				p.opts.OnStuckClose(r)
+			}
+		} else if err != nil {
+			p.log.Error("Closing database failed", "db", r.redactedKey(), "err", err)
+		}
+		return
+	}
+	if err := p.closeResource(r); err != nil {
+		p.log.Error("Closing database failed", "db", r.redactedKey(), "err", err)
+	}
+}
+
+// acquire marks r as used, it fails if r is no longer in the pool or couldn't
+// be reused (see Opts.CanReuse and Opts.OnReuse)
+func (p *Pool) acquire(r *Resource) bool {
+	u, ok := p.use(r)
+	if !ok {
+		return false
+	}
+	if u.reused && p.opts.CanReuse != nil && !p.opts.CanReuse(r) {
+		p.discard(r, u)
+		return false
+	}
+	if u.reused && p.opts.OnReuse != nil {
+		if err := p.opts.OnReuse(r.DB); err != nil {
+			p.discard(r, u)
+			return false
+		}
+	}
+	if p.shouldPing(u) && r.DB.Ping() != nil {
+		p.discard(r, u)
+		return false
+	}
+	if u.activated {
+		p.stateChanged(r, true)
+	}
+	if u.reused {
+		p.idleEnded(r, u.idleFor, true)
+	}
+	return true
+}
+
+// shouldPing reports whether an acquisition must ping its database first (see
+// Opts.PingOnAcquire), databases just opened aren't
+func (p *Pool) shouldPing(u usage) bool {
+	if !p.opts.PingOnAcquire || u.fresh {
+		return false
+	}
+	return p.opts.PingIdleThreshold <= 0 || (u.reused && u.idleFor >= p.opts.PingIdleThreshold)
+}
+
+// discard drops a resource we acquired from the pool, it's closed once its
+// users (including us) release it
+func (p *Pool) discard(r *Resource, u usage) {
+	p.rw.Lock()
+	if p.databases[r.id()] == r {
+		p.removeResource(r.id())
+	}
+	r.retired = true
+	p.rw.Unlock()
+
+	if u.reused {
+		p.idleEnded(r, u.idleFor, false)
+	}
+	p.unuse(r, !u.activated)
+}
+
+// unuse gives back an acquisition of r that never reached its caller: it's
+// neither counted nor reported as an acquisition or a release. reported tells
+// whether r being in use was reported to Opts.OnStateChange, which then hears
+// of it becoming unused.
+func (p *Pool) unuse(r *Resource, reported bool) {
+	p.rw.Lock()
+	atomic.AddInt64(&p.acquires, -1)
+	r.acquires--
+	idle, deactivated, stale := p.leave(r)
+	p.rw.Unlock()
+
+	if deactivated {
+		closeStmts(stale)
+		if reported {
+			p.stateChanged(r, false)
+		}
+	}
+	if idle {
+		p.Cleanup()
+	}
+}
+
+// usage describes how a resource was found by an acquisition
+type usage struct {
+	fresh     bool // never used before
+	reused    bool // was idle
+	activated bool // had no other user
+	idleFor   time.Duration
+}
+
+// use counts a user of r, reporting whether r is still in the pool and how
+// it was found
+func (p *Pool) use(r *Resource) (u usage, ok bool) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	if p.databases[r.id()] != r || p.saturated(r) {
+		return usage{}, false
+	}
+
+	u.activated = !r.users.IsActive()
+	r.users.Inc()
+	atomic.AddInt64(&p.inFlight, 1)
+	atomic.AddInt64(&p.acquires, 1)
+	r.acquires++
+	now := p.now().UnixNano()
+	u.fresh = r.lastActive == 0
+	if _, u.reused = p.inactive[r.id()]; u.reused {
+		u.idleFor = time.Duration(now - r.lastActive)
+	}
+	r.lastActive = now
+	r.idleSweeps = 0
+	p.unsetIdle(r)
+	return u, true
+}
+
+// release updates r's usage and reports whether it became idle, it fails for
+// resources of another pool or that weren't acquired. The pool's
+// stats right after are stored in stats if not nil
+func (p *Pool) release(r *Resource, stats *Stats) (bool, error) {
+	if r.pool != p {
+		return false, p.resourceError(ErrResourceNotManaged, r.Driver, r.Url)
+	}
+
+	// Runs once unlocked
+	deactivated := false
+	var stale []*sql.Stmt
+	defer func() {
+		if deactivated {
+			closeStmts(stale)
+			p.stateChanged(r, false)
+		}
+	}()
+
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	if stats != nil {
+		defer func() { *stats = p.stats() }()
+	}
+
+	if !r.users.IsActive() {
+		// Evicted or replaced since, a resource removed while in use stays
+		// managed until its last user releases it
+		if p.databases[r.id()] != r {
+			return false, p.resourceError(ErrResourceNotManaged, r.Driver, r.Url)
+		}
+		return false, p.resourceError(ErrDoubleRelease, r.Driver, r.Url)
+	}
+	atomic.AddInt64(&p.releases, 1)
+	var idle bool
+	idle, deactivated, stale = p.leave(r)
+	return idle, nil
+}
+
+// leave drops a user of r, reporting whether r became idle and whether it
+// became unused, along with the evicted statements to close then. p.rw must
+// be held
+func (p *Pool) leave(r *Resource) (idle, deactivated bool, stale []*sql.Stmt) {
+	r.users.Dec()
+	atomic.AddInt64(&p.inFlight, -1)
+	r.lastActive = p.now().UnixNano()
+	if r.users.IsActive() {
+		return false, false, nil
+	}
+	stale = r.stmts.takeEvicted()
+
+	// Retired resources are closed by their last user
+	if r.retired {
+		go p.cleanupResource(r)
+		return false, true, stale
+	}
+	if r.pinned && !p.drained {
+		return false, true, stale
+	}
+
+	// No idle retention
+	if p.opts.CloseOnZeroUsers || p.drained {
+		if p.databases[r.id()] == r {
+			p.removeResource(r.id())
+			go p.cleanupResource(r)
+		}
+		return false, true, stale
+	}
+
+	// Mark as idle
+	if p.databases[r.id()] == r {
+		r.idleTimeout = p.idleTimeout(r)
+		p.setIdle(r)
+	}
+	return true, true, stale
+}
+
+func (p *Pool) evicted(r *Resource) {
+	p.log.Debug("Evicted idle database", "db", r.redactedKey())
+	p.emit(EventEvict, r.Driver, r.Url, 0, nil)
+	if p.opts.OnEvict != nil {
+		p.opts.OnEvict(r)
+	}
+}
+
+// bind cancels ctx along with the pool's parent context, see
+// NewPoolWithContext
+func (p *Pool) bind(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.parent.Done() == nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(p.parent, func() {
+		cancel(context.Cause(p.parent))
+	})
+	return ctx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// trace starts a span with Opts.Trace, if any
+func (p *Pool) trace(ctx context.Context, op, driver, url string) (context.Context, func(error)) {
+	if p.opts.Trace == nil {
+		return ctx, func(error) {}
+	}
+	return p.opts.Trace(ctx, op, driver, url)
+}
+
+// idleEnded reports the end of r's idle period to Opts.OnIdleEnd
+func (p *Pool) idleEnded(r *Resource, idleFor time.Duration, reused bool) {
+	if p.opts.OnIdleEnd != nil {
+		p.opts.OnIdleEnd(r, idleFor, reused)
+	}
+}
+
+func (p *Pool) stateChanged(r *Resource, active bool) {
+	if p.opts.OnStateChange != nil {
+		p.opts.OnStateChange(r, active)
+	}
+}
+
+// markIdle makes a resource that was opened without being acquired eligible
+// for idle eviction
+func (p *Pool) markIdle(r *Resource) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	if r.users.IsActive() || r.pinned || p.databases[r.id()] != r {
+		return
+	}
+	if _, ok := p.inactive[r.id()]; !ok {
+		r.lastActive = p.now().UnixNano()
+		r.idleTimeout = p.idleTimeout(r)
+		p.setIdle(r)
+	}
+}
+
+// idleTimeout returns the idle timeout of r, newly idle
+func (p *Pool) idleTimeout(r *Resource) time.Duration {
+	timeout := time.Duration(p.opts.IdleTimeout) * time.Second
+	if r.override != nil && r.override.IdleTimeout > 0 {
+		timeout = r.override.IdleTimeout
+	}
+	if p.opts.IdleTimeoutJitter > 0 {
+		timeout += time.Duration(rand.Int63n(int64(p.opts.IdleTimeoutJitter)))
+	}
+	return timeout
+}
+
+func (p *Pool) open(ctx context.Context, driver, url string) (*Resource, error) {
+	if p.isClosed() {
+		return nil, p.resourceError(ErrPoolClosed, driver, url)
+	}
+
+	lock := "open:" + p.keyOf(driver, url)
+	p.joinOpen(lock)
+	defer p.leaveOpen(lock)
+
+	waited := false
+	for {
+		// DB already opened
+		if r := p.pick(driver, url); r != nil {
+			p.countHit(waited)
+			return r, nil
+		}
+
+		// Open DB: only one should do this, everyone else should wait
+		if p.conds.Lock(lock) {
+			r, err := p.openLocked(ctx, driver, url, waited)
+			p.setOpenResult(lock, err)
+			p.conds.Unlock(lock)
+			return r, err
+		}
+
+		// Someone else opened it while we waited, or failed to
+		if err := p.openResult(lock); err != nil {
+			return nil, err
+		}
+		waited = true
+	}
+}
+
+// opening tracks the callers of open for a database, and the error of its
+// latest open for the ones waiting on it
+type opening struct {
+	callers int
+	err     error
+}
+
+// joinOpen counts a caller of open for lock
+func (p *Pool) joinOpen(lock string) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	o := p.opening[lock]
+	if o == nil {
+		o = &opening{}
+		p.opening[lock] = o
+	}
+	o.callers++
+}
+
+// leaveOpen forgets lock's open error once its last caller is done with it
+func (p *Pool) leaveOpen(lock string) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	if o := p.opening[lock]; o != nil {
+		if o.callers--; o.callers <= 0 {
+			delete(p.opening, lock)
+		}
+	}
+}
+
+// setOpenResult keeps the error of the latest open of lock for its waiters,
+// unless the opener merely gave up: its waiters then open it themselves
+func (p *Pool) setOpenResult(lock string, err error) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	if canceled(err) {
+		err = nil
+	}
+	if o := p.opening[lock]; o != nil {
+		o.err = err
+	}
+}
+
+func (p *Pool) openResult(lock string) error {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	if o := p.opening[lock]; o != nil {
+		return o.err
+	}
+	return nil
+}
+
+// openLocked opens a new instance of the database, unless another one became
+// available in the meantime. It must be called with the open lock held
+func (p *Pool) openLocked(ctx context.Context, driver, url string, waited bool) (*Resource, error) {
+	// Opened by someone else since we checked
+	if r := p.pick(driver, url); r != nil {
+		p.countHit(waited)
+		return r, nil
+	}
+
+	// Don't hammer a database that's down
+	if err := p.checkBackoff(p.keyOf(driver, url)); err != nil {
+		return nil, err
+	}
+
+	// Make room for the new database, unless the pool is full
+	group := p.groupFor(driver, url)
+	if err := p.reserve(ctx, driver, url, group); err != nil {
+		return nil, p.resourceError(err, driver, url)
+	}
+	atomic.AddInt64(&p.opens, 1)
+
+	// Wait for an open slot
+	if p.openSlots != nil {
+		p.openSlots <- struct{}{}
+		defer func() { <-p.openSlots }()
+	}
+
+	start := time.Now()
+	ctx, unbind := p.bind(ctx)
+	ctx, end := p.trace(ctx, "open", driver, url)
+	db, version, err := p.openDB(ctx, driver, url)
+	end(err)
+	unbind()
+	d := time.Since(start)
+	if p.opts.OnSlowOpen != nil && d > p.opts.SlowOpenThreshold {
+		p.opts.OnSlowOpen(p.keyOf(driver, url), d)
+	}
+	if p.opts.OnOpen != nil {
+		p.opts.OnOpen(driver, url, d, err)
+	}
+	p.emit(EventOpen, driver, url, d, err)
+	if err != nil {
+		p.log.Warn("Opening database failed", "db", key(driver, p.redact(url)), "duration", d, "err", err)
+	} else {
+		p.log.Debug("Opened database", "db", key(driver, p.redact(url)), "duration", d)
+	}
+
+	// Add db resource
+	p.rw.Lock()
+	defer p.rw.Unlock()
+	p.reserved--
+	p.room.Broadcast()
+	if err != nil && canceled(err) {
+		// The caller gave up, that says nothing about the database
+		p.leaveGroup(group)
+		return nil, err
+	}
+	p.history.record(p.keyOf(driver, url), p.now(), err)
+	if err != nil {
+		atomic.AddInt64(&p.openErrs, 1)
+		p.leaveGroup(group)
+		p.openFailed(p.keyOf(driver, url))
+		return nil, err
+	}
+	delete(p.reconnects, p.keyOf(driver, url))
+	if p.closed || p.drained || p.draining[driver] {
+		p.leaveGroup(group)
+		db.Close()
+		if p.closed {
+			return nil, p.resourceError(ErrPoolClosed, driver, url)
+		} else if p.drained {
+			return nil, ErrPoolDraining
+		}
+		return nil, ErrDriverDraining
+	}
+	resource := &Resource{
+		DB:       db,
+		Driver:   driver,
+		Url:      url,
+		keyUrl:   p.keyUrl(driver, url),
+		pool:     p,
+		stmts:    newStmtCache(p.opts.StmtCacheSize),
+		instance: p.nextInstance(driver, url),
+		group:    group,
+		version:  version,
+		openedAt: p.now().UnixNano(),
+		override: p.override(driver, url),
+	}
+	resource.setReadOnly(p.readOnly[resource.Key()])
+	p.databases[resource.id()] = resource
+	p.instances[resource.Key()] = append(p.instances[resource.Key()], resource)
+
+	return resource, nil
+}
+
+// reserve counts a database about to be opened against Max and its group's
+// limit, overflow instances of the database skip Max unless
+// Opts.FanoutRespectsMax. Opens waiting for room (see Overflow.Wait) go
+// first come, first served
+func (p *Pool) reserve(ctx context.Context, driver, url, group string) error {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	k := p.keyOf(driver, url)
+	overflow := &Overflow{Driver: driver, Url: url, pool: p, ctx: ctx}
+	defer overflow.dequeue()
+	fanout := len(p.instances[k]) > 0
+	limited := false
+	for (p.full() || overflow.queuedBehind()) && (!fanout || p.opts.FanoutRespectsMax) {
+		// Report the limit once, unlocked, whatever the strategy does
+		if !limited && p.opts.OnLimit != nil {
+			limited = true
+			p.rw.Unlock()
+			p.opts.OnLimit(k)
+			p.rw.Lock()
+			continue
+		}
+		if err := p.overflow().Overflow(overflow); err != nil {
+			return err
+		}
+		fanout = len(p.instances[k]) > 0
+	}
+	if p.opts.GroupFor != nil {
+		if max, ok := p.opts.MaxPerGroup[group]; ok && p.groups[group] >= max {
+			return ErrGroupFull
+		}
+		p.groups[group]++
+	}
+	p.reserved++
+	return nil
+}
+
+// evictLRU closes the least recently used idle resource to make room,
+// reporting whether there was one. It must be called with the lock held
+func (p *Pool) evictLRU() bool {
+	if p.idle.Len() == 0 {
+		return false
+	}
+	lru := p.idle.Front().Value.(*Resource)
+	idleFor := time.Duration(p.now().UnixNano() - lru.lastActive)
+	atomic.AddInt64(&p.evictions, 1)
+	p.removeResource(lru.id())
+	go func() {
+		p.evicted(lru)
+		p.idleEnded(lru, idleFor, false)
+		p.cleanupResource(lru)
+	}()
+	return true
+}
+
+func (p *Pool) groupFor(driver, url string) string {
+	if p.opts.GroupFor == nil {
+		return ""
+	}
+	return p.opts.GroupFor(driver, url)
+}
+
+// leaveGroup must be called with the lock held
+func (p *Pool) leaveGroup(group string) {
+	if p.opts.GroupFor == nil {
+		return
+	}
+	if p.groups[group]--; p.groups[group] <= 0 {
+		delete(p.groups, group)
+	}
+}
+
+func (p *Pool) countHit(waited bool) {
+	if waited {
+		atomic.AddInt64(&p.openWaits, 1)
+	} else {
+		atomic.AddInt64(&p.hits, 1)
+	}
+}
+
+// openDB opens a database, running the init functions around it, and returns
+// its server version. Errors are wrapped in an ErrOpenFailed
+func (p *Pool) openDB(ctx context.Context, driver, url string) (*sql.DB, string, error) {
+	db, err := p.initDB(ctx, driver, url)
+	if err != nil {
+		return nil, "", p.openError(driver, url, err)
+	}
+
+	// Check the server is recent enough
+	version := ""
+	if p.opts.VersionCheck != nil {
+		if version, err = p.opts.VersionCheck(db); err != nil {
+			db.Close()
+			return nil, "", p.openError(driver, url, err)
+		}
+	}
+
+	return db, version, nil
+}
+
+func (p *Pool) initDB(ctx context.Context, driver, url string) (*sql.DB, error) {
+	if p.opts.Opener == nil && driver != ConnectorDriver && !isRegistered(driver) {
+		return nil, ErrUnknownDriver
+	}
+
+	// Before opening DB
+	if p.opts.PreInit != nil {
+		if err := p.opts.PreInit(driver, url); err != nil {
+			return nil, err
+		}
+	}
+	hooks := p.opts.DriverHooks[driver]
+	if hooks.PreInit != nil {
+		if err := hooks.PreInit(driver, url); err != nil {
+			return nil, err
+		}
+	}
+	if p.opts.PreInitContext != nil {
+		if err := p.opts.PreInitContext(ctx, Target{Driver: driver, Url: url}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Open DB
+	db, err := p.openFunc(ctx, driver, url)
+	if err != nil {
+		return nil, err
+	}
+	if p.opts.Tune != nil {
+		p.opts.Tune(driver, url, db)
+	}
+	if hooks.Tune != nil {
+		hooks.Tune(driver, url, db)
+	}
+	override := p.override(driver, url)
+	if override != nil && override.Tune != nil {
+		override.Tune(driver, url, db)
+	}
+
+	// After opening DB
+	if p.opts.PostInit != nil {
+		if err := p.opts.PostInit(driver, url, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if hooks.PostInit != nil {
+		if err := hooks.PostInit(driver, url, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if override != nil && override.PostInit != nil {
+		if err := override.PostInit(driver, url, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if p.opts.PostInitContext != nil {
+		if err := p.opts.PostInitContext(ctx, Target{Driver: driver, Url: url}, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// setIdle makes r idle, as the most recently used idle resource. It must be
+// called with the lock held
+func (p *Pool) setIdle(r *Resource) {
+	p.inactive[r.id()] = r
+	if r.idleElem != nil {
+		p.idle.MoveToBack(r.idleElem)
+	} else {
+		r.idleElem = p.idle.PushBack(r)
+	}
+}
+
+// unsetIdle must be called with the lock held
+func (p *Pool) unsetIdle(r *Resource) {
+	if p.inactive[r.id()] != r {
+		return
+	}
+	delete(p.inactive, r.id())
+	p.idle.Remove(r.idleElem)
+	r.idleElem = nil
+}
+
+// removeResource must be called with the lock held
+func (p *Pool) removeResource(id string) {
+	r := p.databases[id]
+	delete(p.databases, id)
+	if idle := p.inactive[id]; idle != nil {
+		p.unsetIdle(idle)
+	}
+	if r == nil {
+		return
+	}
+	p.room.Broadcast()
+
+	p.leaveGroup(r.group)
+
+	k := r.Key()
+	instances := p.instances[k]
+	for i, x := range instances {
+		if x == r {
+			instances = append(instances[:i:i], instances[i+1:]...)
+			break
+		}
+	}
+	if len(instances) == 0 {
+		delete(p.instances, k)
+	} else {
+		p.instances[k] = instances
+	}
+}
+
+// pick returns an instance of the database that can take another user
+func (p *Pool) pick(driver, url string) *Resource {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	for _, r := range p.instances[p.keyOf(driver, url)] {
+		if !p.saturated(r) {
+			return r
+		}
+	}
+	return nil
+}
+
+// saturated reports whether r has as many users as it may have
+func (p *Pool) saturated(r *Resource) bool {
+	max := p.maxUsers(r.Driver, r.Url)
+	if max <= 0 || r.users.Get() < int64(max) {
+		return false
+	}
+	// No room for another instance, share this one
+	return !(p.opts.FanoutRespectsMax && p.full())
+}
+
+func (p *Pool) isClosed() bool {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+	return p.closed
+}
+
+// full reports whether the pool reached Max, it must be called with the lock
+// held
+func (p *Pool) full() bool {
+	return p.opts.Max > 0 && int64(len(p.databases)+p.reserved) >= p.opts.Max
+}
+
+func (p *Pool) maxUsers(driver, url string) int {
+	if p.opts.MaxUsersFor == nil {
+		return 0
+	}
+	return p.opts.MaxUsersFor(driver, url)
+}
+
+// nextInstance returns the lowest instance number not in use for a key, it
+// must be called with the lock held
+func (p *Pool) nextInstance(driver, url string) int {
+	used := map[int]bool{}
+	for _, r := range p.instances[p.keyOf(driver, url)] {
+		used[r.instance] = true
+	}
+	n := 0
+	for used[n] {
+		n++
+	}
+	return n
+}
+
+// instanceKey identifies the nth instance of a database, the first one uses
+// the database's key
+func instanceKey(driver, url string, n int) string {
+	if n == 0 {
+		return key(driver, url)
+	}
+	return keyEscaper.Replace(driver) + "#" + strconv.Itoa(n) + ":" + url
+}
+
+// Key returns the key a pool without Opts.KeyFunc files a database under, see
+// Pool.Key
+func Key(driver, url string) string {
+	return key(driver, url)
+}
+
+// Key returns the key the pool files a database under, with Opts.KeyFunc
+// applied, as passed to OnLimit, OnSlowOpen, ...
+func (p *Pool) Key(driver, url string) string {
+	return p.keyOf(driver, url)
+}
+
+// keyEscaper escapes the driver's separators so that keys can't collide, e.g.
+// "a:b" + "c" and "a" + "b:c"
+var keyEscaper = strings.NewReplacer("%", "%25", ":", "%3A", "#", "%23")
+
+func key(driver, url string) string {
+	return keyEscaper.Replace(driver) + ":" + url
 }
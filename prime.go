@@ -0,0 +1,113 @@
+package sqlpool
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Prime opens and pings targets in the background, so the pool warms up
+// without a startup spike: MaxConcurrentOpens targets are primed at a time
+// (one if opens aren't limited). Primed databases are left idle in the pool,
+// acquiring a target that isn't primed yet simply opens it as usual.
+//
+// Progress is reported by Stats().Primed.
+func (p *Pool) Prime(targets []Target) {
+	workers := p.opts.MaxConcurrentOpens
+	if workers <= 0 {
+		workers = 1
+	}
+
+	queue := make(chan Target)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				p.prime(t)
+			}
+		}()
+	}
+
+	go func() {
+		for _, t := range targets {
+			queue <- t
+		}
+		close(queue)
+		wg.Wait()
+	}()
+}
+
+// Ensure opens a database without acquiring it, leaving it idle in the pool
+// so that acquiring it later finds it open. It doesn't need to be released,
+// and opens the database only once even with concurrent acquires
+func (p *Pool) Ensure(driver, url string) error {
+	_, err := p.warm(context.Background(), Target{Driver: driver, Url: url})
+	return err
+}
+
+// Warmup opens targets concurrently, MaxConcurrentOpens at a time (GOMAXPROCS
+// if opens aren't limited), and leaves them idle in the pool, so the first
+// requests don't pay for cold opens and PostInit migrations. It waits for
+// them all, targets not started once ctx is done fail with its error. The
+// returned errors match targets, nil for the ones that opened
+func (p *Pool) Warmup(ctx context.Context, targets []Target) []error {
+	workers := p.opts.MaxConcurrentOpens
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	errs := make([]error, len(targets))
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				_, errs[i] = p.warm(ctx, targets[i])
+			}
+		}()
+	}
+	for i := range targets {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	return errs
+}
+
+func (p *Pool) prime(t Target) {
+	r, err := p.warm(context.Background(), t)
+	if err != nil {
+		return
+	}
+
+	if err := r.DB.Ping(); err == nil {
+		atomic.AddInt64(&p.primed, 1)
+	}
+}
+
+// warm opens t without acquiring it, leaving it idle in the pool
+func (p *Pool) warm(ctx context.Context, t Target) (*Resource, error) {
+	if err := p.drainError(t.Driver); err != nil {
+		return nil, err
+	}
+
+	r, err := p.open(ctx, t.Driver, t.Url)
+	if err != nil {
+		return nil, err
+	} else if r == nil {
+		return nil, p.openError(t.Driver, t.Url, errUnknownReason)
+	}
+	p.markIdle(r)
+
+	return r, nil
+}
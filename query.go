@@ -0,0 +1,106 @@
+package sqlpool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// Consecutive failures after which a resource is no longer likely healthy
+const unhealthyFailures = 3
+
+// SetReadOnly marks the database as read-only (or writable again), writes
+// through Resource.ExecContext then fail with ErrReadOnly. The flag sticks to
+// the key so it also applies if the database is reopened later
+func (p *Pool) SetReadOnly(driver, url string, ro bool) {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	k := p.keyOf(driver, url)
+	if ro {
+		p.readOnly[k] = true
+	} else {
+		delete(p.readOnly, k)
+	}
+	for _, r := range p.instances[k] {
+		r.setReadOnly(ro)
+	}
+}
+
+func (r *Resource) ReadOnly() bool {
+	return atomic.LoadInt32(&r.readOnly) == 1
+}
+
+func (r *Resource) setReadOnly(ro bool) {
+	var v int32
+	if ro {
+		v = 1
+	}
+	atomic.StoreInt32(&r.readOnly, v)
+}
+
+// ExecContext runs query on the resource's database, rejecting writes when
+// the resource is read-only
+func (r *Resource) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if r.ReadOnly() && r.isWrite(query) {
+		return nil, ErrReadOnly
+	}
+	res, err := r.DB.ExecContext(ctx, query, args...)
+	r.track(err)
+	return res, err
+}
+
+func (r *Resource) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	r.track(err)
+	return rows, err
+}
+
+func (r *Resource) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.DB.QueryRowContext(ctx, query, args...)
+}
+
+// IsLikelyHealthy reports whether recent queries through the resource's
+// wrappers succeeded. It's a cheap hint that doesn't touch the database,
+// unlike pinging it.
+func (r *Resource) IsLikelyHealthy() bool {
+	return atomic.LoadInt32(&r.failures) < unhealthyFailures
+}
+
+// track records a query's outcome, cancellations don't say anything about
+// the database's health
+func (r *Resource) track(err error) {
+	if err == nil {
+		atomic.StoreInt32(&r.failures, 0)
+		atomic.StoreInt64(&r.trippedAt, 0)
+		atomic.StoreInt64(&r.probedAt, 0)
+	} else if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		failures := atomic.AddInt32(&r.failures, 1)
+		if threshold := r.pool.opts.BreakerThreshold; threshold > 0 && int(failures) >= threshold {
+			atomic.StoreInt64(&r.trippedAt, r.pool.now().UnixNano())
+		}
+	}
+}
+
+func (r *Resource) isWrite(query string) bool {
+	if r.pool != nil && r.pool.opts.IsWrite != nil {
+		return r.pool.opts.IsWrite(query)
+	}
+	return isWriteQuery(query)
+}
+
+// isWriteQuery is the default statement classifier, it only looks at the
+// leading keyword
+func isWriteQuery(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "INSERT", "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package sqlpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Scoped is an acquisition made by AcquireScoped, released once its context
+// is done unless it was released manually before
+type Scoped struct {
+	*Resource
+	once sync.Once
+	done chan struct{}
+}
+
+// settle marks the acquisition as released, only the first caller gets true
+func (s *Scoped) settle() bool {
+	settled := false
+	s.once.Do(func() {
+		settled = true
+		close(s.done)
+	})
+	return settled
+}
+
+// AcquireScoped acquires a resource that is released automatically once ctx
+// is done, so callers can't forget to. Releasing it manually (with
+// Scoped.Release) before ctx is done is fine and stops the watcher,
+// releasing it after fails with ErrDoubleRelease.
+//
+// Every call spawns a watcher goroutine: this is meant for special cases like
+// request-scoped databases, not for the hot path where Acquire should be used.
+func (p *Pool) AcquireScoped(ctx context.Context, driver, url string) (*Scoped, error) {
+	r, err := p.Acquire(driver, url)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scoped{Resource: r, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			if s.settle() {
+				p.releaseResource(context.Background(), r)
+			}
+		case <-s.done:
+		}
+	}()
+
+	return s, nil
+}
+
+// Release releases this scoped acquisition of the resource, unless its
+// context already did
+func (s *Scoped) Release() error {
+	if !s.settle() {
+		return s.pool.resourceError(ErrDoubleRelease, s.Driver, s.Url)
+	}
+	return s.Resource.Release()
+}
+
+// Close releases the acquisition, see Resource.Close
+func (s *Scoped) Close() error {
+	return s.Release()
+}
@@ -0,0 +1,69 @@
+// Package sqlpooltest provides a sqlpool.Opener for unit tests of code built
+// on sqlpool, handing out sqlmock databases instead of real ones
+package sqlpooltest
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/GitbookIO/go-sqlpool"
+)
+
+// Opener opens a new sqlmock database every time the pool opens one, e.g.
+//
+//	opener := sqlpooltest.NewOpener()
+//	pool := sqlpool.NewPool(sqlpool.Opts{Opener: opener})
+//	r, _ := pool.Acquire("postgres", "tenant-1")
+//	opener.Mock("postgres", "tenant-1").ExpectExec("UPDATE").WillReturnResult(...)
+type Opener struct {
+	mu    sync.Mutex
+	mocks map[string]sqlmock.Sqlmock
+	err   map[string]error
+}
+
+var _ sqlpool.Opener = (*Opener)(nil)
+
+func NewOpener() *Opener {
+	return &Opener{
+		mocks: map[string]sqlmock.Sqlmock{},
+		err:   map[string]error{},
+	}
+}
+
+func (o *Opener) Open(driver, url string) (*sql.DB, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	k := sqlpool.Key(driver, url)
+	if err := o.err[k]; err != nil {
+		return nil, err
+	}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		return nil, err
+	}
+	o.mocks[k] = mock
+	return db, nil
+}
+
+// Mock returns the mock of the database latest opened for driver and url,
+// nil if it wasn't opened
+func (o *Opener) Mock(driver, url string) sqlmock.Sqlmock {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.mocks[sqlpool.Key(driver, url)]
+}
+
+// FailWith makes opening driver and url fail with err, or succeed again if
+// err is nil
+func (o *Opener) FailWith(driver, url string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err == nil {
+		delete(o.err, sqlpool.Key(driver, url))
+	} else {
+		o.err[sqlpool.Key(driver, url)] = err
+	}
+}
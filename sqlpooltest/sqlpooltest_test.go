@@ -0,0 +1,43 @@
+package sqlpooltest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/GitbookIO/go-sqlpool"
+)
+
+func TestOpener(t *testing.T) {
+	opener := NewOpener()
+	pool := sqlpool.NewPool(sqlpool.Opts{
+		Max:         10,
+		IdleTimeout: 30,
+		Opener:      opener,
+	})
+	defer pool.Close()
+
+	r, err := pool.Acquire("postgres", "tenant-1")
+	if err != nil {
+		t.Fatalf("Error opening mock database: %s", err)
+	}
+	defer pool.Release(r)
+
+	mock := opener.Mock("postgres", "tenant-1")
+	mock.ExpectExec("UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, err := r.DB.Exec("UPDATE accounts SET active = 1"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	down := errors.New("down")
+	opener.FailWith("postgres", "tenant-2", down)
+	if _, err := pool.Acquire("postgres", "tenant-2"); !errors.Is(err, down) {
+		t.Errorf("Expected the open to fail, got %v", err)
+	}
+	if opener.Mock("postgres", "tenant-2") != nil {
+		t.Errorf("Expected no mock for a failed open")
+	}
+}
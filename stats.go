@@ -0,0 +1,114 @@
+package sqlpool
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// ResourceStats describes a single resource of the pool
+type ResourceStats struct {
+	Key      string // without credentials
+	Driver   string
+	Url      string // without credentials
+	Instance int    // see Resource.Instance
+
+	Users      int64
+	Acquires   int64
+	OpenedAt   time.Time
+	LastActive time.Time
+	Breaker    BreakerState
+	DBStats    sql.DBStats
+
+	// When opening another instance of the key may be retried, zero unless
+	// it's backing off (see Opts.ReconnectBackoff)
+	NextRetry time.Time
+
+	// The latest opens of the key, remembered after its resources are gone
+	LastOpenSuccess time.Time
+	LastOpenFailure time.Time
+	LastOpenError   string
+	OpenErrors      int64 // while the key is remembered
+}
+
+// ResourceStats describes every resource of the pool, sorted by key
+func (p *Pool) ResourceStats() []ResourceStats {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	return p.resourceStats()
+}
+
+// resourceStats must be called with the lock held
+func (p *Pool) resourceStats() []ResourceStats {
+	stats := make([]ResourceStats, 0, len(p.databases))
+	for _, r := range p.databases {
+		stats = append(stats, r.stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Key != stats[j].Key {
+			return stats[i].Key < stats[j].Key
+		}
+		return stats[i].Instance < stats[j].Instance
+	})
+
+	return stats
+}
+
+// KeyStats describes the resource of a key, without scanning the whole pool.
+// The boolean reports whether the key is in the pool, when it isn't only the
+// key's open history is filled in
+func (p *Pool) KeyStats(driver, url string) (ResourceStats, bool) {
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+
+	instances := p.instances[p.keyOf(driver, url)]
+	if len(instances) == 0 {
+		stats := ResourceStats{
+			Key:    key(driver, p.redact(p.keyUrl(driver, url))),
+			Driver: driver,
+			Url:    p.redact(url),
+		}
+		p.history.fill(p.keyOf(driver, url), &stats)
+		stats.NextRetry = p.nextRetry(p.keyOf(driver, url))
+		return stats, false
+	}
+	return instances[0].stats(), true
+}
+
+// addDBStats sums the stats of two databases
+func addDBStats(a, b sql.DBStats) sql.DBStats {
+	return sql.DBStats{
+		MaxOpenConnections: a.MaxOpenConnections + b.MaxOpenConnections,
+
+		OpenConnections: a.OpenConnections + b.OpenConnections,
+		InUse:           a.InUse + b.InUse,
+		Idle:            a.Idle + b.Idle,
+
+		WaitCount:         a.WaitCount + b.WaitCount,
+		WaitDuration:      a.WaitDuration + b.WaitDuration,
+		MaxIdleClosed:     a.MaxIdleClosed + b.MaxIdleClosed,
+		MaxIdleTimeClosed: a.MaxIdleTimeClosed + b.MaxIdleTimeClosed,
+		MaxLifetimeClosed: a.MaxLifetimeClosed + b.MaxLifetimeClosed,
+	}
+}
+
+// stats must be called with the pool's lock held
+func (r *Resource) stats() ResourceStats {
+	stats := ResourceStats{
+		Key:      r.redactedKey(),
+		Driver:   r.Driver,
+		Url:      r.pool.redact(r.Url),
+		Instance: r.instance,
+
+		Users:      r.users.Get(),
+		Acquires:   r.acquires,
+		OpenedAt:   time.Unix(0, r.openedAt),
+		LastActive: time.Unix(0, r.lastActive),
+		Breaker:    r.breaker(),
+		DBStats:    r.DB.Stats(),
+		NextRetry:  r.pool.nextRetry(r.Key()),
+	}
+	r.pool.history.fill(r.Key(), &stats)
+	return stats
+}
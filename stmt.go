@@ -0,0 +1,118 @@
+package sqlpool
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// stmtCache is a LRU of prepared statements keyed by query
+type stmtCache struct {
+	mu    sync.Mutex
+	size  int // zero is unbounded
+	lru   *list.List
+	stmts map[string]*list.Element
+
+	// Evicted statements, possibly still used by the resource's current
+	// users: they're closed once it has none
+	evicted []*sql.Stmt
+}
+
+type cachedStmt struct {
+	query string
+	stmt  *sql.Stmt
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		lru:   list.New(),
+		stmts: map[string]*list.Element{},
+	}
+}
+
+// PreparedContext returns a prepared statement for query, preparing it only
+// once per resource. The statement belongs to the cache: don't close it, and
+// don't keep it past releasing the resource since it's closed once evicted
+// from the cache (see Opts.StmtCacheSize) and the resource has no users
+// left, or when the resource is closed.
+func (r *Resource) PreparedContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	c := r.stmts
+	if stmt, ok := c.get(query); ok {
+		return stmt, nil
+	}
+
+	// Prepare unlocked, not to hold up other queries
+	stmt, err := r.DB.PrepareContext(ctx, query)
+	r.track(err)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Someone else was quicker
+	if e, ok := c.stmts[query]; ok {
+		stmt.Close()
+		c.lru.MoveToFront(e)
+		return e.Value.(*cachedStmt).stmt, nil
+	}
+	c.stmts[query] = c.lru.PushFront(&cachedStmt{query: query, stmt: stmt})
+
+	// Evict least recently used
+	if c.size > 0 && c.lru.Len() > c.size {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		evicted := e.Value.(*cachedStmt)
+		delete(c.stmts, evicted.query)
+		c.evicted = append(c.evicted, evicted.stmt)
+	}
+
+	return stmt, nil
+}
+
+// get returns the cached statement for query, if any
+func (c *stmtCache) get(query string) (*sql.Stmt, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.stmts[query]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cachedStmt).stmt, true
+}
+
+// takeEvicted hands over the evicted statements for closing, it must only
+// be called once the resource has no users
+func (c *stmtCache) takeEvicted() []*sql.Stmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	evicted := c.evicted
+	c.evicted = nil
+	return evicted
+}
+
+// clear closes all cached statements
+func (c *stmtCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		e.Value.(*cachedStmt).stmt.Close()
+	}
+	closeStmts(c.evicted)
+	c.evicted = nil
+	c.lru.Init()
+	c.stmts = map[string]*list.Element{}
+}
+
+func closeStmts(stmts []*sql.Stmt) {
+	for _, stmt := range stmts {
+		stmt.Close()
+	}
+}
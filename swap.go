@@ -0,0 +1,93 @@
+package sqlpool
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SwapDB installs newDB for a database already in the pool, e.g. after its
+// credentials were rotated: acquisitions get newDB from now on while current
+// users keep the previous *sql.DB, which is closed once they release it. All
+// the database's instances are replaced by newDB.
+//
+// It fails with ErrResourceNotFound if the database isn't in the pool
+func (p *Pool) SwapDB(driver, url string, newDB *sql.DB) error {
+	return p.swap(driver, url, newDB, "")
+}
+
+// Refresh reopens a database already in the pool, running the same hooks as
+// acquires do (OpenMiddleware, PreInit, PostInit, VersionCheck...), and
+// installs the new *sql.DB with SwapDB, e.g. to pick up rotated credentials
+// without downtime. If reopening fails the current one is kept.
+//
+// It fails with ErrResourceNotFound if the database isn't in the pool
+func (p *Pool) Refresh(driver, url string) error {
+	if _, ok := p.Peek(driver, url); !ok {
+		return ErrResourceNotFound
+	}
+
+	db, version, err := p.openDB(context.Background(), driver, url)
+	if err != nil {
+		return err
+	}
+	if err := p.swap(driver, url, db, version); err != nil {
+		db.Close()
+		return err
+	}
+	return nil
+}
+
+// swap installs newDB for the database, with version or else the previous
+// version
+func (p *Pool) swap(driver, url string, newDB *sql.DB, version string) error {
+	p.rw.Lock()
+	defer p.rw.Unlock()
+
+	old := append([]*Resource{}, p.instances[p.keyOf(driver, url)]...)
+	if len(old) == 0 {
+		return ErrResourceNotFound
+	}
+
+	// Retire the previous instances
+	pinned := false
+	for _, r := range old {
+		pinned = pinned || r.pinned
+		p.removeResource(r.id())
+		if r.users.IsActive() {
+			r.retired = true
+		} else {
+			go p.cleanupResource(r)
+		}
+	}
+
+	if version == "" {
+		version = old[0].version
+	}
+	resource := &Resource{
+		DB:      newDB,
+		Driver:  driver,
+		Url:     url,
+		keyUrl:  p.keyUrl(driver, url),
+		pool:    p,
+		stmts:   newStmtCache(p.opts.StmtCacheSize),
+		group:   p.groupFor(driver, url),
+		version: version,
+		pinned:  pinned,
+
+		openedAt: p.now().UnixNano(),
+		override: p.override(driver, url),
+	}
+	resource.setReadOnly(p.readOnly[resource.Key()])
+	if p.opts.GroupFor != nil {
+		p.groups[resource.group]++
+	}
+	p.databases[resource.id()] = resource
+	p.instances[resource.Key()] = []*Resource{resource}
+	if !pinned {
+		resource.lastActive = p.now().UnixNano()
+		resource.idleTimeout = p.idleTimeout(resource)
+		p.setIdle(resource)
+	}
+
+	return nil
+}
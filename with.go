@@ -0,0 +1,22 @@
+package sqlpool
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// With acquires the database, runs fn with it and releases it, even if fn
+// panics. It returns fn's error, joined with the release's
+func (p *Pool) With(driver, url string, fn func(db *sql.DB) error) (err error) {
+	r, err := p.Acquire(driver, url)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if releaseErr := p.Release(r); releaseErr != nil {
+			err = errors.Join(err, releaseErr)
+		}
+	}()
+
+	return fn(r.DB)
+}